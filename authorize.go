@@ -0,0 +1,183 @@
+package ucan
+
+import (
+	"context"
+	"fmt"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/ipfs/go-cid"
+)
+
+var (
+	WrongAudienceError = fmt.Errorf("ucan is not addressed to this service")
+	NotAuthorizedError = fmt.Errorf("capability not granted")
+)
+
+// DefaultMaxProofs bounds the number of proofs sent along with a single ucan
+const DefaultMaxProofs = 32
+
+// Authorizer decides whether ucans sent to a service grant the capabilities
+// needed for a request. A capability is granted when the ucan is addressed to
+// the service, its proof chain is valid and one of the trusted roots, the
+// service itself by default, originates a capability enabling the request.
+type Authorizer struct {
+	audience    string
+	semantics   capability.Semantics
+	roots       map[string]bool
+	store       ContextUcanStore
+	maxProofs   int
+	revocations []RevocationChecker
+	replayGuard *ReplayGuard
+}
+
+func NewAuthorizer(audience string, semantics capability.Semantics) *Authorizer {
+	return &Authorizer{
+		audience:  audience,
+		semantics: semantics,
+		roots:     map[string]bool{audience: true},
+		store:     NewMemoryStore(),
+		maxProofs: DefaultMaxProofs,
+	}
+}
+
+// WithRoots replaces the dids trusted to originate capabilities
+func (a *Authorizer) WithRoots(dids ...string) *Authorizer {
+	a.roots = make(map[string]bool, len(dids))
+	for _, did := range dids {
+		a.roots[did] = true
+	}
+	return a
+}
+
+// WithStore sets the store holding proofs not sent along with the ucan
+func (a *Authorizer) WithStore(store ContextUcanStore) *Authorizer {
+	a.store = store
+	return a
+}
+
+// WithMaxProofs sets the maximum number of proofs accepted along with a ucan
+func (a *Authorizer) WithMaxProofs(n int) *Authorizer {
+	a.maxProofs = n
+	return a
+}
+
+// WithRevocationChecker adds a checker consulted for every ucan of the chain
+func (a *Authorizer) WithRevocationChecker(checker RevocationChecker) *Authorizer {
+	a.revocations = append(a.revocations, checker)
+	return a
+}
+
+// WithReplayGuard makes the authorizer accept every ucan sent to it only once
+func (a *Authorizer) WithReplayGuard(guard *ReplayGuard) *Authorizer {
+	a.replayGuard = guard
+	return a
+}
+
+func (a *Authorizer) Audience() string {
+	return a.audience
+}
+
+// Authorize verifies the encoded ucan with the encoded proofs sent along with
+// it and returns the reduced capability covering the resource and ability of
+// requested. The caveat of requested holds the json arguments of the request,
+// which must satisfy the caveat of the granted capability.
+func (a *Authorizer) Authorize(ctx context.Context, token string, proofs []string, requested *capability.Capability) (*CapabilityInfo, error) {
+	uc, err := DecodeUcanString(token)
+	if err != nil {
+		return nil, err
+	}
+	return a.AuthorizeUcan(ctx, uc, proofs, requested)
+}
+
+func (a *Authorizer) AuthorizeUcan(ctx context.Context, uc *Ucan, proofs []string, requested *capability.Capability) (*CapabilityInfo, error) {
+	if uc.Audience() != a.audience {
+		return nil, fmt.Errorf("%w: audience is %s", WrongAudienceError, uc.Audience())
+	}
+	if len(proofs) > a.maxProofs {
+		return nil, fmt.Errorf("too many proofs: %d, at most %d are accepted", len(proofs), a.maxProofs)
+	}
+	requestedView, err := a.semantics.ParseCapability(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewProofChainBuilder(&requestProofs{proofs: proofs, store: a.store}).
+		WithReplayGuard(a.replayGuard)
+	for _, checker := range a.revocations {
+		builder.WithRevocationChecker(checker)
+	}
+	pc, err := builder.FromUcan(ctx, uc, nil)
+	if err != nil {
+		return nil, err
+	}
+	capInfos, err := ReduceCapabilitiesWith(pc, a.semantics)
+	if err != nil {
+		return nil, err
+	}
+
+	args := requestedView.Caveat
+	if len(args) == 0 {
+		args = capability.NullJson
+	}
+	var violation error
+	for _, capInfo := range capInfos {
+		if !capInfo.Capability.Covers(requestedView) || !a.fromRoot(capInfo) {
+			continue
+		}
+		err = capInfo.Permits(args)
+		if err == nil {
+			return capInfo, nil
+		}
+		if violation == nil {
+			violation = err
+		}
+	}
+	if violation != nil {
+		return nil, fmt.Errorf("%w: %s %s: %w", NotAuthorizedError, requested.Ability, requested.Resource, violation)
+	}
+	return nil, fmt.Errorf("%w: %s %s", NotAuthorizedError, requested.Ability, requested.Resource)
+}
+
+func (a *Authorizer) fromRoot(capInfo *CapabilityInfo) bool {
+	for originator := range capInfo.Originators {
+		if a.roots[originator] {
+			return true
+		}
+	}
+	return false
+}
+
+var _ ContextUcanStore = &requestProofs{}
+
+// requestProofs resolves proofs sent along with a ucan before falling back to
+// the store of the authorizer, proofs are matched whatever cid prefix they are
+// referenced with.
+type requestProofs struct {
+	proofs []string
+	store  ContextUcanStore
+}
+
+func (rp *requestProofs) ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	str, err := rp.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeUcanString(str)
+}
+
+func (rp *requestProofs) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	for _, prf := range rp.proofs {
+		prfCid, err := c.Prefix().Sum([]byte(prf))
+		if err == nil && prfCid.Equals(c) {
+			return prf, nil
+		}
+	}
+	return rp.store.ReadUcanStrContext(ctx, c)
+}
+
+func (rp *requestProofs) WriteUcanContext(ctx context.Context, uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, fmt.Errorf("proofs of a request are read only")
+}
+
+func (rp *requestProofs) WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, fmt.Errorf("proofs of a request are read only")
+}
@@ -0,0 +1,140 @@
+package ucan
+
+import (
+	"context"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// grantAndInvoke lets the service alice grant bob access to the photos api,
+// bob then invokes it with a ucan addressed back to alice
+func grantAndInvoke(t *testing.T, prefix *cid.Prefix) (string, string) {
+	grant, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(capability.NewCapability("https://api.example.com/photos", "http/get", capability.NullJson)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.AliceDidString).
+		WithLifetime(50).
+		WitnessedBy(grant, prefix).
+		ClaimingCapability(capability.NewCapability("https://api.example.com/photos/1", "http/get", capability.NullJson)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grantStr, err := grant.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocationStr, err := invocation.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invocationStr, grantStr
+}
+
+func TestAuthorizesRequestsWithProofsSentAlong(t *testing.T) {
+	sha256Prefix := &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	token, grant := grantAndInvoke(t, sha256Prefix)
+	authorizer := NewAuthorizer(fixtures.TestIdentities.AliceDidString, capability.HTTPSemantics)
+	ctx := context.Background()
+
+	capInfo, err := authorizer.Authorize(ctx, token, []string{grant},
+		capability.NewCapability("https://api.example.com/photos/1", "http/head", capability.NullJson))
+	assert.NoError(t, err)
+	assert.True(t, capInfo.Originators[fixtures.TestIdentities.AliceDidString])
+
+	_, err = authorizer.Authorize(ctx, token, []string{grant},
+		capability.NewCapability("https://api.example.com/photos/1", "http/delete", capability.NullJson))
+	assert.ErrorIs(t, err, NotAuthorizedError)
+
+	_, err = authorizer.Authorize(ctx, token, nil,
+		capability.NewCapability("https://api.example.com/photos/1", "http/get", capability.NullJson))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, NotAuthorizedError)
+
+	_, err = authorizer.WithMaxProofs(0).Authorize(ctx, token, []string{grant},
+		capability.NewCapability("https://api.example.com/photos/1", "http/get", capability.NullJson))
+	assert.Error(t, err)
+}
+
+func TestAuthorizesProofsFromTheStore(t *testing.T) {
+	token, grant := grantAndInvoke(t, nil)
+	store := NewMemoryStore()
+	_, err := store.WriteUcanStr(grant, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizer := NewAuthorizer(fixtures.TestIdentities.AliceDidString, capability.HTTPSemantics).WithStore(store)
+	_, err = authorizer.Authorize(context.Background(), token, nil,
+		capability.NewCapability("https://api.example.com/photos/1", "http/get", capability.NullJson))
+	assert.NoError(t, err)
+}
+
+func TestRejectsUcansOfOtherServicesAndRoots(t *testing.T) {
+	token, grant := grantAndInvoke(t, nil)
+	requested := capability.NewCapability("https://api.example.com/photos/1", "http/get", capability.NullJson)
+
+	_, err := NewAuthorizer(fixtures.TestIdentities.MalloryDidString, capability.HTTPSemantics).
+		Authorize(context.Background(), token, []string{grant}, requested)
+	assert.ErrorIs(t, err, WrongAudienceError)
+
+	_, err = NewAuthorizer(fixtures.TestIdentities.AliceDidString, capability.HTTPSemantics).
+		WithRoots(fixtures.TestIdentities.MalloryDidString).
+		Authorize(context.Background(), token, []string{grant}, requested)
+	assert.ErrorIs(t, err, NotAuthorizedError)
+}
+
+func TestChecksCaveatsAgainstRequestArguments(t *testing.T) {
+	grant, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(capability.NewCapability("https://api.example.com/photos", "http/get",
+			[]byte(`{"pol": [["<=", ".size", 10]]}`))).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.AliceDidString).
+		WithLifetime(50).
+		DelegatingFrom(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grantStr, err := grant.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer := NewAuthorizer(fixtures.TestIdentities.AliceDidString, capability.HTTPSemantics)
+	ctx := context.Background()
+
+	capInfo, err := authorizer.AuthorizeUcan(ctx, invocation, []string{grantStr},
+		capability.NewCapability("https://api.example.com/photos/1", "http/get", []byte(`{"size": 5}`)))
+	assert.NoError(t, err)
+	assert.True(t, capInfo.Originators[fixtures.TestIdentities.AliceDidString])
+
+	_, err = authorizer.AuthorizeUcan(ctx, invocation, []string{grantStr},
+		capability.NewCapability("https://api.example.com/photos/1", "http/get", []byte(`{"size": 50}`)))
+	assert.ErrorIs(t, err, NotAuthorizedError)
+	assert.ErrorIs(t, err, capability.CaveatViolationError)
+
+	_, err = authorizer.AuthorizeUcan(ctx, invocation, []string{grantStr},
+		capability.NewCapability("https://api.example.com/photos/1", "http/get", capability.NullJson))
+	assert.ErrorIs(t, err, NotAuthorizedError)
+}
@@ -0,0 +1,448 @@
+// Package boltstore keeps ucans in a bbolt database, indexed by issuer,
+// audience, resource, ability and expiry so stored tokens can be queried.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/ipfs/go-cid"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// compactTxMaxSize bounds the size of the transactions used by Compact
+const compactTxMaxSize = 64 << 10
+
+var (
+	ucansBucket      = []byte("ucans")
+	metaBucket       = []byte("meta")
+	byIssuerBucket   = []byte("by-issuer")
+	byAudienceBucket = []byte("by-audience")
+	byResourceBucket = []byte("by-resource")
+	byAbilityBucket  = []byte("by-ability")
+	byExpiryBucket   = []byte("by-expiry")
+)
+
+var _ ucan.EnumerableUcanStore = &Store{}
+
+// Store is a UcanStore backed by a bbolt database file
+type Store struct {
+	// lk is held exclusively while Compact replaces db
+	lk   sync.RWMutex
+	path string
+	db   *bolt.DB
+}
+
+// record is the indexed part of a stored token
+type record struct {
+	Iss  string     `json:"iss"`
+	Aud  string     `json:"aud"`
+	Exp  *int64     `json:"exp,omitempty"`
+	Nbf  *int64     `json:"nbf,omitempty"`
+	Caps [][]string `json:"caps,omitempty"`
+}
+
+// Open opens or creates the database at path
+func Open(path string) (*Store, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: path, db: db}, nil
+}
+
+func openDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{ucansBucket, metaBucket, byIssuerBucket, byAudienceBucket, byResourceBucket, byAbilityBucket, byExpiryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (s *Store) Close() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.db.Close()
+}
+
+func (s *Store) ReadUcan(c cid.Cid) (*ucan.Ucan, error) {
+	str, err := s.ReadUcanStr(c)
+	if err != nil {
+		return nil, err
+	}
+	return ucan.DecodeUcanString(str)
+}
+
+func (s *Store) WriteUcan(uc *ucan.Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	c, str, err := uc.ToCid(prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, s.put(c, str, uc)
+}
+
+func (s *Store) ReadUcanStr(c cid.Cid) (string, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	var str string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(ucansBucket).Get(c.Bytes())
+		if data == nil {
+			return fmt.Errorf("%w: %s", ucan.UcanNotFoundError, c.String())
+		}
+		str = string(data)
+		return nil
+	})
+	return str, err
+}
+
+func (s *Store) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
+	uc, err := ucan.DecodeUcanString(str)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if prefix == nil {
+		prefix = &ucan.DefaultPrefix
+	}
+	c, err := prefix.Sum([]byte(str))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, s.put(c, str, uc)
+}
+
+func (s *Store) Has(c cid.Cid) (bool, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(ucansBucket).Get(c.Bytes()) != nil
+		return nil
+	})
+	return found, err
+}
+
+// Delete removes the token stored under c and its index entries, deleting a
+// missing token is not an error
+func (s *Store) Delete(c cid.Cid) error {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteTx(tx, c.Bytes())
+	})
+}
+
+// List returns the cids of all stored tokens
+func (s *Store) List() ([]cid.Cid, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	cids := make([]cid.Cid, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(ucansBucket).ForEach(func(k, _ []byte) error {
+			c, err := cid.Cast(k)
+			if err != nil {
+				return err
+			}
+			cids = append(cids, c)
+			return nil
+		})
+	})
+	return cids, err
+}
+
+func (s *Store) put(c cid.Cid, str string, uc *ucan.Ucan) error {
+	prefix := c.Prefix()
+	err := ucan.CheckPrefix(&prefix)
+	if err != nil {
+		return err
+	}
+	rec := record{Iss: uc.Issuer(), Aud: uc.Audience(), Exp: uc.Expires(), Nbf: uc.NotBefore()}
+	for _, capa := range uc.Capabilities().ToCapsArray() {
+		rec.Caps = append(rec.Caps, []string{capa.Resource, capa.Ability})
+	}
+	meta, err := json.Marshal(&rec)
+	if err != nil {
+		return err
+	}
+
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := c.Bytes()
+		if tx.Bucket(ucansBucket).Get(key) != nil {
+			return nil
+		}
+		if err := tx.Bucket(ucansBucket).Put(key, []byte(str)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(metaBucket).Put(key, meta); err != nil {
+			return err
+		}
+		return forEachIndexKey(key, &rec, func(bucket []byte, indexKey []byte) error {
+			return tx.Bucket(bucket).Put(indexKey, nil)
+		})
+	})
+}
+
+func deleteTx(tx *bolt.Tx, key []byte) error {
+	meta := tx.Bucket(metaBucket).Get(key)
+	if meta == nil {
+		return nil
+	}
+	rec := record{}
+	if err := json.Unmarshal(meta, &rec); err != nil {
+		return err
+	}
+	err := forEachIndexKey(key, &rec, func(bucket []byte, indexKey []byte) error {
+		return tx.Bucket(bucket).Delete(indexKey)
+	})
+	if err != nil {
+		return err
+	}
+	if err = tx.Bucket(metaBucket).Delete(key); err != nil {
+		return err
+	}
+	return tx.Bucket(ucansBucket).Delete(key)
+}
+
+// forEachIndexKey calls fn with the index entries of a token, entries are
+// "<value>\x00<cid>" and "<big endian exp><cid>" for the expiry index
+func forEachIndexKey(key []byte, rec *record, fn func(bucket []byte, indexKey []byte) error) error {
+	if err := fn(byIssuerBucket, stringKey(rec.Iss, key)); err != nil {
+		return err
+	}
+	if err := fn(byAudienceBucket, stringKey(rec.Aud, key)); err != nil {
+		return err
+	}
+	for _, capa := range rec.Caps {
+		if err := fn(byResourceBucket, stringKey(capa[0], key)); err != nil {
+			return err
+		}
+		if err := fn(byAbilityBucket, stringKey(capa[1], key)); err != nil {
+			return err
+		}
+	}
+	if rec.Exp != nil {
+		if err := fn(byExpiryBucket, expiryKey(*rec.Exp, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stringKey(value string, key []byte) []byte {
+	indexKey := make([]byte, 0, len(value)+1+len(key))
+	indexKey = append(indexKey, value...)
+	indexKey = append(indexKey, 0)
+	return append(indexKey, key...)
+}
+
+// expiryKey orders keys by expiry, negative expiries are clamped to zero
+func expiryKey(exp int64, key []byte) []byte {
+	if exp < 0 {
+		exp = 0
+	}
+	indexKey := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(key)), uint64(exp))
+	return append(indexKey, key...)
+}
+
+// Query selects stored tokens, empty fields match every token. Tokens match a
+// resource or ability when one of their capabilities has it.
+type Query struct {
+	Issuer   string
+	Audience string
+	Resource string
+	Ability  string
+	// ActiveAt keeps tokens which are neither expired nor too early at the time
+	ActiveAt *time.Time
+	// ExpiresBefore keeps tokens expiring before the time
+	ExpiresBefore *time.Time
+}
+
+// Find returns the cids of the tokens matched by q, the most selective index
+// of q is scanned and the other conditions are checked against each token.
+func (s *Store) Find(q Query) ([]cid.Cid, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	cids := make([]cid.Cid, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return q.scan(tx, func(key []byte) error {
+			meta := tx.Bucket(metaBucket).Get(key)
+			if meta == nil {
+				return nil
+			}
+			rec := record{}
+			if err := json.Unmarshal(meta, &rec); err != nil {
+				return err
+			}
+			if !q.matches(&rec) {
+				return nil
+			}
+			c, err := cid.Cast(key)
+			if err != nil {
+				return err
+			}
+			cids = append(cids, c)
+			return nil
+		})
+	})
+	return cids, err
+}
+
+// ActiveDelegations returns the tokens delegating resource to audience which are active at now
+func (s *Store) ActiveDelegations(audience string, resource string, now time.Time) ([]cid.Cid, error) {
+	return s.Find(Query{Audience: audience, Resource: resource, ActiveAt: &now})
+}
+
+// ExpiringWithin returns the tokens which are not expired yet at now but expire within d
+func (s *Store) ExpiringWithin(now time.Time, d time.Duration) ([]cid.Cid, error) {
+	before := now.Add(d)
+	return s.Find(Query{ActiveAt: &now, ExpiresBefore: &before})
+}
+
+func (q *Query) scan(tx *bolt.Tx, fn func(key []byte) error) error {
+	switch {
+	case q.Issuer != "":
+		return scanPrefix(tx.Bucket(byIssuerBucket), stringKey(q.Issuer, nil), fn)
+	case q.Audience != "":
+		return scanPrefix(tx.Bucket(byAudienceBucket), stringKey(q.Audience, nil), fn)
+	case q.Resource != "":
+		return scanPrefix(tx.Bucket(byResourceBucket), stringKey(q.Resource, nil), fn)
+	case q.Ability != "":
+		return scanPrefix(tx.Bucket(byAbilityBucket), stringKey(q.Ability, nil), fn)
+	case q.ExpiresBefore != nil:
+		cur := tx.Bucket(byExpiryBucket).Cursor()
+		end := expiryKey(q.ExpiresBefore.Unix(), nil)
+		for k, _ := cur.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = cur.Next() {
+			if err := fn(k[8:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return tx.Bucket(ucansBucket).ForEach(func(k, _ []byte) error {
+			return fn(k)
+		})
+	}
+}
+
+// scanPrefix calls fn with the cid of every index entry starting with prefix
+func scanPrefix(bucket *bolt.Bucket, prefix []byte, fn func(key []byte) error) error {
+	cur := bucket.Cursor()
+	for k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Next() {
+		if err := fn(k[len(prefix):]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Query) matches(rec *record) bool {
+	if q.Issuer != "" && rec.Iss != q.Issuer {
+		return false
+	}
+	if q.Audience != "" && rec.Aud != q.Audience {
+		return false
+	}
+	if q.Resource != "" || q.Ability != "" {
+		found := false
+		for _, capa := range rec.Caps {
+			if (q.Resource == "" || capa[0] == q.Resource) && (q.Ability == "" || capa[1] == q.Ability) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.ActiveAt != nil {
+		now := q.ActiveAt.Unix()
+		if (rec.Exp != nil && *rec.Exp < now) || (rec.Nbf != nil && *rec.Nbf > now) {
+			return false
+		}
+	}
+	if q.ExpiresBefore != nil && (rec.Exp == nil || *rec.Exp >= q.ExpiresBefore.Unix()) {
+		return false
+	}
+	return true
+}
+
+// CollectGarbage deletes the tokens which expired before now and returns how
+// many were deleted
+func (s *Store) CollectGarbage(now time.Time) (int, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		expired := make([][]byte, 0)
+		cur := tx.Bucket(byExpiryBucket).Cursor()
+		end := expiryKey(now.Unix(), nil)
+		for k, _ := cur.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = cur.Next() {
+			expired = append(expired, append([]byte(nil), k[8:]...))
+		}
+		for _, key := range expired {
+			if err := deleteTx(tx, key); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	return deleted, err
+}
+
+// Compact rewrites the database into a new file, releasing the space of
+// deleted tokens which bbolt keeps for reuse. The store keeps serving from the
+// uncompacted database until the compacted one is open and in place.
+func (s *Store) Compact() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	tmpPath := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".compact")
+	_ = os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	err = bolt.Compact(dst, s.db, compactTxMaxSize)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	// the open compacted database follows its file through the rename
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		dst.Close()
+		return err
+	}
+	old := s.db
+	s.db = dst
+	return old.Close()
+}
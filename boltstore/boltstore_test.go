@@ -0,0 +1,145 @@
+package boltstore
+
+import (
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/key"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T) *Store {
+	store, err := Open(filepath.Join(t.TempDir(), "ucans.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	return store
+}
+
+func delegate(t *testing.T, store *Store, issuer key.KeyMaterial, audience string, resource string, exp time.Time) cid.Cid {
+	uc, err := ucan.DefaultBuilder().
+		IssuedBy(issuer).
+		ForAudience(audience).
+		WithExpiration(exp.Unix()).
+		ClaimingCapability(capability.NewCapability(resource, "wnfs/overwrite", capability.NullJson)).
+		WithNonce().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := store.WriteUcan(uc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestQueriesIndexedTokens(t *testing.T) {
+	store := openStore(t)
+	now := time.Now()
+	alice, bob := fixtures.TestIdentities.AliceKey, fixtures.TestIdentities.BobKey
+	photos := "wnfs://alice.fission.name/public/photos/"
+
+	toBob := delegate(t, store, alice, fixtures.TestIdentities.BobDidString, photos, now.Add(time.Hour*2))
+	expiringToBob := delegate(t, store, alice, fixtures.TestIdentities.BobDidString, photos, now.Add(time.Minute))
+	expiredToBob := delegate(t, store, alice, fixtures.TestIdentities.BobDidString, photos, now.Add(-time.Minute))
+	toMallory := delegate(t, store, bob, fixtures.TestIdentities.MalloryDidString, photos, now.Add(time.Hour*2))
+	otherResource := delegate(t, store, alice, fixtures.TestIdentities.BobDidString, "wnfs://alice.fission.name/private", now.Add(time.Hour*2))
+
+	cids, err := store.ActiveDelegations(fixtures.TestIdentities.BobDidString, photos, now)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []cid.Cid{toBob, expiringToBob}, cids)
+
+	cids, err = store.ExpiringWithin(now, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{expiringToBob}, cids)
+
+	cids, err = store.Find(Query{Issuer: fixtures.TestIdentities.BobDidString})
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{toMallory}, cids)
+
+	cids, err = store.Find(Query{Ability: "wnfs/overwrite", Resource: "wnfs://alice.fission.name/private"})
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{otherResource}, cids)
+
+	cids, err = store.Find(Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(cids))
+
+	deleted, err := store.CollectGarbage(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	has, err := store.Has(expiredToBob)
+	assert.NoError(t, err)
+	assert.False(t, has)
+	cids, err = store.Find(Query{Audience: fixtures.TestIdentities.BobDidString})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []cid.Cid{toBob, expiringToBob, otherResource}, cids)
+}
+
+func TestCompactionKeepsTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ucans.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	kept := delegate(t, store, fixtures.TestIdentities.AliceKey, fixtures.TestIdentities.BobDidString, "mailto:alice@email.com", now.Add(time.Hour))
+	for i := 0; i < 20; i++ {
+		c := delegate(t, store, fixtures.TestIdentities.AliceKey, fixtures.TestIdentities.BobDidString, "mailto:alice@email.com", now.Add(time.Hour))
+		assert.NoError(t, store.Delete(c))
+	}
+	assert.NoError(t, store.Compact())
+
+	_, err = store.ReadUcan(kept)
+	assert.NoError(t, err)
+	// the swapped in database keeps taking writes and compactions
+	deleted := delegate(t, store, fixtures.TestIdentities.AliceKey, fixtures.TestIdentities.BobDidString, "mailto:alice@email.com", now.Add(time.Hour))
+	assert.NoError(t, store.Delete(deleted))
+	assert.NoError(t, store.Compact())
+	assert.NoError(t, store.Close())
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{kept}, cids)
+	cids, err = store.Find(Query{Resource: "mailto:alice@email.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{kept}, cids)
+
+	_, err = store.ReadUcanStr(cid.Undef)
+	assert.ErrorIs(t, err, ucan.UcanNotFoundError)
+}
+
+func TestRejectsWeakPrefixes(t *testing.T) {
+	store := openStore(t)
+	uc, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteUcan(uc, &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.MURMUR3X64_64, MhLength: -1})
+	assert.ErrorIs(t, err, ucan.UnsupportedPrefixError)
+	str, err := uc.Encode()
+	assert.NoError(t, err)
+	_, err = store.WriteUcanStr(str, &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: 16})
+	assert.ErrorIs(t, err, ucan.UnsupportedPrefixError)
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, cids)
+}
@@ -155,11 +155,10 @@ func TestCustomPrefix(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// murmur3 does not protect the integrity of the proof, since CheckPrefix
+	// chains referencing it are rejected
 	_, err = ProofChainFromUcan(delegatedToken, nil, store)
-	if err != nil {
-		t.Fatal(err)
-	}
-
+	assert.ErrorIs(t, err, UnsupportedPrefixError)
 }
 
 //func TestMalloryKey(t *testing.T) {
@@ -184,3 +183,13 @@ func TestCustomPrefix(t *testing.T) {
 //
 //	t.Logf("%#v", dp)
 //}
+
+func TestReportsInvalidFactsInsteadOfPanicking(t *testing.T) {
+	_, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(30).
+		WithFact("abc/challenge", "not json").
+		Build()
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package capability
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NotComparable is returned by Ability.Compare when neither ability enables the other
+const NotComparable = -2
+
+// WildcardAbility enables every ability
+const WildcardAbility = "*"
+
+// AbilityImplications declares which abilities a concrete ability implies,
+// for example crud/update implying crud/read. Implications are followed
+// transitively and may point at namespace wildcards such as crud/*.
+type AbilityImplications interface {
+	Implied(ability string) []string
+}
+
+var _ AbilityImplications = NoImplications{}
+
+// NoImplications is used by namespaces whose abilities only enable themselves
+type NoImplications struct{}
+
+func (NoImplications) Implied(ability string) []string {
+	return nil
+}
+
+var _ AbilityImplications = AbilityDAG{}
+
+// AbilityDAG maps abilities to the abilities they directly imply
+type AbilityDAG map[string][]string
+
+func (dag AbilityDAG) Implied(ability string) []string {
+	return dag[ability]
+}
+
+// ValidateAbility checks str is *, a namespaced ability like crud/read or a
+// namespace wildcard like crud/*
+func ValidateAbility(str string) error {
+	if str == WildcardAbility {
+		return nil
+	}
+	segments := strings.Split(str, "/")
+	if len(segments) < 2 {
+		return fmt.Errorf("ability must be namespaced: %s", str)
+	}
+	for idx, seg := range segments {
+		if seg == "" {
+			return fmt.Errorf("empty segment in ability: %s", str)
+		}
+		if strings.Contains(seg, "*") && (seg != "*" || idx != len(segments)-1) {
+			return fmt.Errorf("wildcard is only allowed as last segment: %s", str)
+		}
+	}
+	return nil
+}
+
+// EnablesAbility reports whether the granted ability enables the requested one:
+// * enables everything, ns/* enables every ability below ns/ and concrete
+// abilities enable themselves and what they imply.
+func EnablesAbility(granted string, requested string, implications AbilityImplications) bool {
+	return enablesAbility(granted, requested, implications, make(map[string]bool))
+}
+
+func enablesAbility(granted string, requested string, implications AbilityImplications, visited map[string]bool) bool {
+	if granted == requested || granted == WildcardAbility {
+		return true
+	}
+	if requested == WildcardAbility {
+		return false
+	}
+	if strings.HasSuffix(granted, "/*") {
+		return strings.HasPrefix(requested, strings.TrimSuffix(granted, "*"))
+	}
+	if visited[granted] || implications == nil {
+		return false
+	}
+	visited[granted] = true
+	for _, implied := range implications.Implied(granted) {
+		if enablesAbility(implied, requested, implications, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareAbilities implements Ability.Compare for namespaced abilities
+func CompareAbilities(ability string, other string, implications AbilityImplications) int {
+	switch {
+	case ability == other:
+		return 0
+	case EnablesAbility(ability, other, implications):
+		return 1
+	case EnablesAbility(other, ability, implications):
+		return -1
+	default:
+		return NotComparable
+	}
+}
+
+// AbilityNamespace may be implemented by the implications of a NamespacedAbility
+// to only accept * and the abilities of one namespace
+type AbilityNamespace interface {
+	Namespace() string
+}
+
+// NamespacedAbility is an ability following the UCAN ability syntax, H declares
+// the implications between its abilities through its zero value.
+type NamespacedAbility[H AbilityImplications] struct {
+	name string
+}
+
+func (a NamespacedAbility[H]) ParseAbility(str string) (Ability, error) {
+	err := ValidateAbility(str)
+	if err != nil {
+		return nil, err
+	}
+	var implications H
+	if ns, ok := any(implications).(AbilityNamespace); ok && str != WildcardAbility && !strings.HasPrefix(str, ns.Namespace()+"/") {
+		return nil, fmt.Errorf("ability %s is not in namespace %s", str, ns.Namespace())
+	}
+	return &NamespacedAbility[H]{name: str}, nil
+}
+
+func (a NamespacedAbility[H]) ToString() string {
+	return a.name
+}
+
+func (a NamespacedAbility[H]) Compare(abi Ability) int {
+	other, ok := abi.(*NamespacedAbility[H])
+	if !ok {
+		return NotComparable
+	}
+	var implications H
+	return CompareAbilities(a.name, other.name, implications)
+}
+
+var crudImplications = AbilityDAG{
+	"crud/update": {"crud/read"},
+	"crud/delete": {"crud/read"},
+}
+
+// CrudImplications lets crud/update and crud/delete enable crud/read
+type CrudImplications struct{}
+
+func (CrudImplications) Implied(ability string) []string {
+	return crudImplications.Implied(ability)
+}
+
+func (CrudImplications) Namespace() string {
+	return "crud"
+}
+
+// CrudAbility is the crud namespace, e.g. crud/* enables crud/read
+type CrudAbility = NamespacedAbility[CrudImplications]
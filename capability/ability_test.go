@@ -0,0 +1,80 @@
+package capability
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func mustCrudAbility(t *testing.T, str string) Ability {
+	abi, err := CrudAbility{}.ParseAbility(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abi
+}
+
+func TestWildcardAbilities(t *testing.T) {
+	all := mustCrudAbility(t, "*")
+	allCrud := mustCrudAbility(t, "crud/*")
+	read := mustCrudAbility(t, "crud/read")
+	create := mustCrudAbility(t, "crud/create")
+
+	assert.Equal(t, 1, all.Compare(allCrud))
+	assert.Equal(t, 1, all.Compare(read))
+	assert.Equal(t, 1, allCrud.Compare(read))
+	assert.Equal(t, -1, read.Compare(allCrud))
+	assert.Equal(t, -1, allCrud.Compare(all))
+	assert.Equal(t, 0, read.Compare(mustCrudAbility(t, "crud/read")))
+	assert.Equal(t, NotComparable, read.Compare(create))
+}
+
+func TestAbilityImplications(t *testing.T) {
+	read := mustCrudAbility(t, "crud/read")
+	update := mustCrudAbility(t, "crud/update")
+	deleteAbi := mustCrudAbility(t, "crud/delete")
+
+	assert.Equal(t, 1, update.Compare(read))
+	assert.Equal(t, -1, read.Compare(update))
+	assert.Equal(t, NotComparable, update.Compare(deleteAbi))
+
+	dag := AbilityDAG{
+		"admin/all":   {"msg/*", "crud/update"},
+		"cycle/a":     {"cycle/b"},
+		"cycle/b":     {"cycle/a"},
+		"crud/update": {"crud/read"},
+	}
+	assert.True(t, EnablesAbility("admin/all", "msg/send", dag))
+	assert.True(t, EnablesAbility("admin/all", "crud/read", dag))
+	assert.False(t, EnablesAbility("admin/all", "crud/delete", dag))
+	assert.True(t, EnablesAbility("cycle/a", "cycle/b", dag))
+	assert.False(t, EnablesAbility("cycle/a", "cycle/c", dag))
+	assert.False(t, EnablesAbility("msg/*", "msgs/send", dag))
+}
+
+func TestRejectsInvalidAbilities(t *testing.T) {
+	for _, invalid := range []string{"", "read", "crud/", "crud//read", "crud/re*d", "crud/*/read", "msg/send"} {
+		_, err := CrudAbility{}.ParseAbility(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestIncomparableAbilitiesDoNotPanic(t *testing.T) {
+	email, err := EmailAction{}.ParseAbility("email/send")
+	if err != nil {
+		t.Fatal(err)
+	}
+	level, err := WNFSCapLevel{}.ParseAbility("wnfs/create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegate, err := ProofAction{}.ParseAbility("ucan/DELEGATE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := mustCrudAbility(t, "crud/read")
+
+	assert.Equal(t, NotComparable, email.Compare(level))
+	assert.Equal(t, NotComparable, level.Compare(email))
+	assert.Equal(t, NotComparable, delegate.Compare(read))
+	assert.Equal(t, NotComparable, read.Compare(delegate))
+}
@@ -183,18 +183,17 @@ func TestFindsTheRightProofChainForTheOriginator(t *testing.T) {
 	}
 
 	assert.Equal(t, len(capInfos), 2)
-	assert.Equal(t, capInfos[0], &CapabilityInfo{
+	assert.ElementsMatch(t, []*CapabilityInfo{{
 		Originators: map[string]bool{fixtures.TestIdentities.BobDidString: true},
 		NotBefore:   ucan.NotBefore(),
 		Expires:     ucan.Expires(),
 		Capability:  *sendEmailAsBob,
-	})
-	assert.Equal(t, capInfos[1], &CapabilityInfo{
+	}, {
 		Originators: map[string]bool{fixtures.TestIdentities.AliceDidString: true},
 		Capability:  *sendEmailAsAlice,
 		NotBefore:   ucan.NotBefore(),
 		Expires:     ucan.Expires(),
-	})
+	}}, capInfos)
 
 }
 
@@ -391,7 +390,7 @@ func TestCastBetweenMapAndSequence(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	assert.Equal(t, capsFromJsonBytes.ToCapsArray(), capSequence)
+	assert.ElementsMatch(t, capSequence, capsFromJsonBytes.ToCapsArray())
 
 	capsFromSequence, err := capability.BuildCapsFromArray(capSequence)
 	if err != nil {
@@ -466,3 +465,278 @@ func TestCapsSerAndDeser(t *testing.T) {
 	err = json.Unmarshal(capsBytes, &reCaps)
 	t.Logf("%#v", reCaps)
 }
+
+func TestMyResourcesAreRootedAtTheIssuer(t *testing.T) {
+	store := NewMemoryStore()
+	allOfAlice, err := capability.EmailSemantics.Parse("my:*", "email/send", []byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendEmailAsAlice, err := capability.EmailSemantics.Parse(
+		fmt.Sprintf("as:%s:mailto:alice@email.com", fixtures.TestIdentities.AliceDidString), "email/send", []byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, capability.AS, int(sendEmailAsAlice.Resource.Type))
+	assert.Equal(t, fixtures.TestIdentities.AliceDidString, sendEmailAsAlice.Resource.Did)
+
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(allOfAlice.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafChain, err := ProofChainFromUcan(leafUcan, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err := ReduceCapabilities[capability.EmailAddress, capability.EmailAction](leafChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(capInfos))
+	assert.Equal(t, fixtures.TestIdentities.AliceDidString, capInfos[0].Owner)
+	assert.Equal(t, map[string]bool{fixtures.TestIdentities.AliceDidString: true}, capInfos[0].Originators)
+
+	ucan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(leafUcan, nil).
+		ClaimingCapability(sendEmailAsAlice.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := ProofChainFromUcan(ucan, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err = ReduceCapabilities[capability.EmailAddress, capability.EmailAction](pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(capInfos))
+	assert.Equal(t, &CapabilityInfo{
+		Originators: map[string]bool{fixtures.TestIdentities.AliceDidString: true},
+		NotBefore:   ucan.NotBefore(),
+		Expires:     ucan.Expires(),
+		Capability:  *sendEmailAsAlice,
+		Owner:       fixtures.TestIdentities.AliceDidString,
+	}, capInfos[0])
+}
+
+func TestRejectsAsResourcesNotRootedAtTheOwner(t *testing.T) {
+	store := NewMemoryStore()
+	allOfMallory, err := capability.EmailSemantics.Parse("my:*", "email/send", []byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendEmailAsAlice, err := capability.EmailSemantics.Parse(
+		fmt.Sprintf("as:%s:mailto:alice@email.com", fixtures.TestIdentities.AliceDidString), "email/send", []byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.MalloryKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(allOfMallory.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ucan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.AliceDidString).
+		WithLifetime(50).
+		WitnessedBy(leafUcan, nil).
+		ClaimingCapability(sendEmailAsAlice.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := ProofChainFromUcan(ucan, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err := ReduceCapabilities[capability.EmailAddress, capability.EmailAction](pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(capInfos))
+}
+
+func TestKeepsMyResourcesOfDifferentOwnersApart(t *testing.T) {
+	store := NewMemoryStore()
+	allOfIssuer, err := capability.EmailSemantics.Parse("my:*", "email/send", []byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(allOfIssuer.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	malloryUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.MalloryKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(allOfIssuer.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uc := range []*Ucan{aliceUcan, malloryUcan} {
+		_, err = store.WriteUcan(uc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ucan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.AliceDidString).
+		WithLifetime(50).
+		DelegatingFrom(aliceUcan, nil).
+		DelegatingFrom(malloryUcan, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := ProofChainFromUcan(ucan, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err := ReduceCapabilities[capability.EmailAddress, capability.EmailAction](pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := make([]string, 0)
+	for _, capInfo := range capInfos {
+		assert.Equal(t, map[string]bool{capInfo.Owner: true}, capInfo.Originators)
+		owners = append(owners, capInfo.Owner)
+	}
+	assert.ElementsMatch(t, []string{fixtures.TestIdentities.AliceDidString, fixtures.TestIdentities.MalloryDidString}, owners)
+}
+
+func TestPermitsInvocationsWithinTheCaveats(t *testing.T) {
+	store := NewMemoryStore()
+	sendNewsletter, err := capability.EmailSemantics.Parse("mailto:alice@email.com", "email/send",
+		[]byte(`{"template": "newsletter", "pol": [["<=", ".max_count", 5]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(sendNewsletter.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ucan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(leafUcan, nil).
+		ClaimingCapability(sendNewsletter.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := ProofChainFromUcan(ucan, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err := ReduceCapabilities[capability.EmailAddress, capability.EmailAction](pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(capInfos))
+
+	assert.NoError(t, capInfos[0].Permits([]byte(`{"max_count": 3, "template": "newsletter"}`)))
+
+	err = capInfos[0].Permits([]byte(`{"max_count": 30, "template": "newsletter"}`))
+	var violation *capability.CaveatViolation
+	assert.ErrorAs(t, err, &violation)
+	assert.Equal(t, `["<=",".max_count",5]`, violation.Clause)
+
+	err = capInfos[0].Permits([]byte(`{"max_count": 3, "template": "marketing"}`))
+	assert.ErrorIs(t, err, capability.CaveatViolationError)
+	assert.Contains(t, err.Error(), `["==",".template","newsletter"]`)
+}
+
+func TestRedelegatesEverythingFromAProof(t *testing.T) {
+	store := NewMemoryStore()
+	sendEmailAsAlice, err := capability.EmailSemantics.Parse("mailto:alice@email.com", "email/send", []byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(sendEmailAsAlice.ToCapability()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ucan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		DelegatingFrom(leafUcan, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := ProofChainFromUcan(ucan, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err := ReduceCapabilities[capability.EmailAddress, capability.EmailAction](pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(capInfos))
+	assert.Equal(t, map[string]bool{fixtures.TestIdentities.AliceDidString: true}, capInfos[0].Originators)
+	assert.Equal(t, "mailto:alice@email.com", capInfos[0].Capability.Resource.ToString())
+}
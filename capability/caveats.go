@@ -7,6 +7,25 @@ import (
 	"github.com/KenCloud-Tech/go-ucan-kc/util"
 )
 
+var (
+	InvalidCaveatError   = fmt.Errorf("invalid caveat")
+	CaveatViolationError = fmt.Errorf("caveat violation")
+)
+
+// CaveatViolation reports the caveat clause an invocation did not satisfy
+type CaveatViolation struct {
+	// Clause is the json form of the failed statement, or the failed field of a typed caveat
+	Clause string
+}
+
+func (v *CaveatViolation) Error() string {
+	return fmt.Sprintf("%s: %s", CaveatViolationError, v.Clause)
+}
+
+func (v *CaveatViolation) Unwrap() error {
+	return CaveatViolationError
+}
+
 type Caveat struct {
 	caveat map[string]interface{}
 }
@@ -26,22 +45,51 @@ func (c *Caveat) isEmpty() bool {
 	return c.caveat == nil || len(c.caveat) == 0
 }
 
+// equalOrContain reports whether other is at least as strict as c, i.e. every
+// invocation allowed by other is also allowed by c
 func (c *Caveat) equalOrContain(other *Caveat) bool {
 	if c == other {
 		return true
 	}
 
-	for str, cav := range c.caveat {
-		if oCav, ok := other.caveat[str]; !ok {
-			return false
-		} else {
-			// todo:  judgement of equality, not implement now
-			if cav != oCav {
-				return false
-			}
+	policy, err := c.Policy()
+	if err != nil {
+		return false
+	}
+	otherPolicy, err := other.Policy()
+	if err != nil {
+		return false
+	}
+	return otherPolicy.Implies(policy)
+}
+
+// Policy compiles the caveat into policy statements, see PolicyCaveatKey
+func (c *Caveat) Policy() (Policy, error) {
+	return compilePolicy(c.caveat)
+}
+
+// Check evaluates the caveat against the json arguments of an invocation, it
+// returns a *CaveatViolation naming the first clause which is not satisfied.
+func (c *Caveat) Check(args []byte) error {
+	if c.isEmpty() {
+		return nil
+	}
+	policy, err := c.Policy()
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if len(bytes.TrimSpace(args)) > 0 {
+		err = json.Unmarshal(args, &doc)
+		if err != nil {
+			return fmt.Errorf("invalid invocation arguments: %w", err)
 		}
 	}
-	return true
+	if failed := policy.Evaluate(doc); failed != nil {
+		return &CaveatViolation{Clause: failed.String()}
+	}
+	return nil
 }
 
 func BuildCaveat(val []byte) (Caveat, error) {
@@ -27,3 +27,35 @@ func TestEmptyCaveats(t *testing.T) {
 	}
 	assert.Equal(t, cvThree.Caveat, NullJson)
 }
+
+func TestChecksInvocationArguments(t *testing.T) {
+	unrestricted, err := BuildCaveat([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, unrestricted.Check(nil))
+	assert.NoError(t, unrestricted.Check([]byte(`{"anything": true}`)))
+
+	restricted, err := BuildCaveat([]byte(`{"pol": [["all", ".to", ["like", ".", "*@email.com"]]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, restricted.Check([]byte(`{"to": ["bob@email.com", "alice@email.com"]}`)))
+	assert.ErrorIs(t, restricted.Check([]byte(`{"to": ["bob@email.com", "eve@evil.com"]}`)), CaveatViolationError)
+	// missing arguments can not satisfy a restricted caveat
+	assert.ErrorIs(t, restricted.Check(nil), CaveatViolationError)
+
+	err = restricted.Check([]byte(`{"to": `))
+	assert.Contains(t, err.Error(), "invalid invocation arguments")
+}
+
+func TestBuildCapabilityRejectsInvalidCaveats(t *testing.T) {
+	for _, caveat := range []string{"", "[]", `"x"`, `{"a":`} {
+		_, err := BuildCapability("mailto:alice@email.com", "email/send", []byte(caveat))
+		assert.ErrorIs(t, err, InvalidCaveatError, caveat)
+	}
+	c, err := BuildCapability("mailto:alice@email.com", "email/send", NullJson)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", c.Caveat)
+	assert.Panics(t, func() { NewCapability("mailto:alice@email.com", "email/send", []byte("[]")) })
+}
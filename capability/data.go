@@ -12,17 +12,28 @@ type Capability struct {
 	Caveat   interface{}
 }
 
+// NewCapability panics if caveat is not a json object, use BuildCapability
+// for caveats that are not known to be valid.
 func NewCapability(resource string, ability string, caveat []byte) *Capability {
+	c, err := BuildCapability(resource, ability, caveat)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// BuildCapability is NewCapability returning an InvalidCaveatError instead of panicking
+func BuildCapability(resource string, ability string, caveat []byte) (*Capability, error) {
 	isJson, jsonBytes := util.IsJson(caveat)
-	if !isJson {
-		panic(fmt.Sprintf("caveat must be json object, but got: %v", caveat))
+	if !isJson || !util.IsJsonObject(jsonBytes) {
+		return nil, fmt.Errorf("%w: caveat must be json object, but got: %s", InvalidCaveatError, caveat)
 	}
 	return &Capability{
 		Resource: resource,
 		Ability:  ability,
 		// todo: if cav is not string(json object), get error while ucan unmarshal
 		Caveat: string(jsonBytes),
-	}
+	}, nil
 }
 
 // Abilities
@@ -35,12 +46,15 @@ type Abilities map[string][]interface{}
 // A capability is the association of an "Ability" to a "Resource": Resource x Ability x caveats.
 // { $RESOURCE: { $ABILITY: [ $CAVEATS ] } }
 //
+// Caveat fields are equality constraints, except "pol" which holds policy
+// statements, see PolicyCaveatKey.
+//
 //{
 //  "example://example.com/public/photos/": {
 //    "crud/read": [{}],
 //    "crud/delete": [
 //      {
-//        "matching": "/(?i)(\\W|^)(baloney|darn|drat|fooey|gosh\\sdarnit|heck)(\\W|$)/"
+//        "pol": [["regex", ".path", "^/public/photos/drafts/"]]
 //      }
 //    ]
 //  },
@@ -51,10 +65,9 @@ type Abilities map[string][]interface{}
 //    "msg/send": [{}],
 //    "msg/receive": [
 //      {
-//        "max_count": 5,
-//        "templates": [
-//          "newsletter",
-//          "marketing"
+//        "pol": [
+//          ["<=", ".max_count", 5],
+//          ["in", ".template", ["newsletter", "marketing"]]
 //        ]
 //      }
 //    ]
@@ -1,13 +1,21 @@
 package capability
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
-	"strings"
 )
 
 var EmailSemantics = CapabilitySemantics[EmailAddress, EmailAction]{}
 
+// TypedEmailSemantics is EmailSemantics with EmailCaveat caveats
+var TypedEmailSemantics = TypedCapabilitySemantics[EmailAddress, EmailAction, EmailCaveat]{}
+
+var (
+	_ Semantics = EmailSemantics
+	_ Semantics = TypedEmailSemantics
+)
+
 var _ Scope = &EmailAddress{}
 
 type EmailAddress struct {
@@ -17,9 +25,8 @@ type EmailAddress struct {
 func (e EmailAddress) Contains(other Scope) bool {
 	if ea, ok := other.(*EmailAddress); ok {
 		return ea.str == e.str
-	} else {
-		panic(fmt.Sprintf("invalid comparing between EmailAddress and %T", other))
 	}
+	return false
 }
 
 func (e EmailAddress) ParseScope(url url.URL) (Scope, error) {
@@ -45,7 +52,7 @@ func (e EmailAction) Compare(abi Ability) int {
 	if _, ok := abi.(*EmailAction); ok {
 		return 0
 	}
-	panic(fmt.Sprintf("comparing between different ability: %t and %t", e, abi))
+	return NotComparable
 }
 
 func (e EmailAction) ParseAbility(str string) (Ability, error) {
@@ -59,49 +66,99 @@ func (e EmailAction) ToString() string {
 	return "email/send"
 }
 
-var WNFSSemantics = CapabilitySemantics[WNFSScope, WNFSCapLevel]{}
-
-var _ Scope = &WNFSScope{}
+var _ TypedCaveat[EmailCaveat] = EmailCaveat{}
 
-type WNFSScope struct {
-	origin string
-	path   string
+// EmailCaveat limits how many emails can be sent and with which templates,
+// zero values are unrestricted
+type EmailCaveat struct {
+	MaxCount  int      `json:"max_count,omitempty"`
+	Templates []string `json:"templates,omitempty"`
 }
 
-func (w WNFSScope) Contains(other Scope) bool {
-	if otherWNFS, ok := other.(*WNFSScope); !ok {
+func (e EmailCaveat) Narrows(other EmailCaveat) bool {
+	if other.MaxCount > 0 && (e.MaxCount == 0 || e.MaxCount > other.MaxCount) {
 		return false
-	} else {
-		if otherWNFS.origin != w.origin {
+	}
+	if len(other.Templates) > 0 {
+		if len(e.Templates) == 0 {
 			return false
 		}
-		pathParts := strings.Split(w.path, "/")
-		otherPathParts := strings.Split(otherWNFS.path, "/")
-
-		for _, part := range pathParts {
-			if len(otherPathParts) == 0 {
+		for _, template := range e.Templates {
+			if !e.allowsTemplate(other.Templates, template) {
 				return false
 			}
-			otherPart := otherPathParts[0]
-			otherPathParts = otherPathParts[1:]
+		}
+	}
+	return true
+}
 
-			if part != otherPart {
-				return false
-			}
+func (e EmailCaveat) allowsTemplate(templates []string, template string) bool {
+	for _, t := range templates {
+		if t == template {
+			return true
 		}
 	}
+	return false
+}
 
-	return true
+func (e EmailCaveat) Validate() error {
+	if e.MaxCount < 0 {
+		return fmt.Errorf("max_count must not be negative: %d", e.MaxCount)
+	}
+	return nil
+}
+
+// CheckArguments checks invocations of the form {"max_count": 3, "template": "newsletter"},
+// the same arguments the caveat policies of EmailSemantics constrain
+func (e EmailCaveat) CheckArguments(args []byte) error {
+	var invocation struct {
+		MaxCount int    `json:"max_count"`
+		Template string `json:"template"`
+	}
+	if len(args) > 0 {
+		err := json.Unmarshal(args, &invocation)
+		if err != nil {
+			return fmt.Errorf("invalid invocation arguments: %w", err)
+		}
+	}
+	if e.MaxCount > 0 && invocation.MaxCount > e.MaxCount {
+		return &CaveatViolation{Clause: "max_count"}
+	}
+	if len(e.Templates) > 0 && !e.allowsTemplate(e.Templates, invocation.Template) {
+		return &CaveatViolation{Clause: "templates"}
+	}
+	return nil
+}
+
+var WNFSSemantics = CapabilitySemantics[WNFSScope, WNFSCapLevel]{}
+
+var _ Scope = &WNFSScope{}
+
+type WNFSScope struct {
+	origin string
+	path   string
+}
+
+func (w WNFSScope) Contains(other Scope) bool {
+	otherWNFS, ok := other.(*WNFSScope)
+	if !ok || otherWNFS.origin != w.origin {
+		return false
+	}
+	return segmentsHavePrefix(pathSegments(otherWNFS.path), pathSegments(w.path))
 }
 
 func (w WNFSScope) ParseScope(url url.URL) (Scope, error) {
-	sch, host, path := url.Scheme, url.Host, url.Path
+	sch, host := url.Scheme, url.Host
 	if sch != "wnfs" {
 		return nil, fmt.Errorf("cannot interpret URI as WNFS scope: %s", url.String())
 	}
+	segments, err := NormalizePath(url.EscapedPath())
+	if err != nil {
+		return nil, err
+	}
 	return &WNFSScope{
 		origin: host,
-		path:   path,
+		path:   joinSegments(segments),
 	}, nil
 }
 
@@ -143,32 +200,28 @@ func (w WNFSCapLevel) ParseAbility(str string) (Ability, error) {
 }
 
 func (w WNFSCapLevel) ToString() string {
-	if _, exist := levelMap[w.level]; exist {
-		return string(w.level)
-	}
-	panic(fmt.Sprintf("invalid WNFSCapLevel: %s", w.level))
+	return string(w.level)
 }
 
 func (w WNFSCapLevel) Compare(abi Ability) int {
-	var otherWeight = -1
-	//var ok bool
-	if otherWNFS, ok := abi.(*WNFSCapLevel); !ok {
-		panic(fmt.Sprintf("comparing between different ability: %T and %T", w, abi))
-	} else {
-		if otherWeight, ok = levelMap[otherWNFS.level]; !ok {
-			panic(fmt.Sprintf("invalid WNFSCapLevel: %s", otherWNFS.level))
-		}
+	otherWNFS, ok := abi.(*WNFSCapLevel)
+	if !ok {
+		return NotComparable
+	}
+	otherWeight, ok := levelMap[otherWNFS.level]
+	if !ok {
+		return NotComparable
+	}
+	weight, ok := levelMap[w.level]
+	if !ok {
+		return NotComparable
 	}
 
-	if weight, exist := levelMap[w.level]; !exist {
-		panic(fmt.Sprintf("invalid WNFSCapLevel: %s", w.level))
+	if weight == otherWeight {
+		return 0
+	} else if weight > otherWeight {
+		return 1
 	} else {
-		if weight == otherWeight {
-			return 0
-		} else if weight > otherWeight {
-			return 1
-		} else {
-			return -1
-		}
+		return -1
 	}
 }
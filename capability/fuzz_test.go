@@ -0,0 +1,59 @@
+package capability
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func FuzzParseAndCompareCapabilities(f *testing.F) {
+	f.Add("mailto:alice@email.com", "email/send", `{}`, "mailto:alice@email.com", "email/send", `{"max_count":1}`)
+	f.Add("prf:0", "ucan/DELEGATE", ``, "prf:*", "ucan/DELEGATE", `{}`)
+	f.Add("prf:x", "ucan/DELEGATE", `[]`, "prf:-3", "ucan/DELEGATE", `null`)
+	f.Add("wnfs://alice/photos/", "wnfs/create", `{}`, "wnfs://alice/photos2", "wnfs/super_user", `{}`)
+	f.Add("my:*", "*", `{"pol":[["==",".a",1]]}`, "as:did:key:z:mailto:a", "crud/*", `{"pol":"x"}`)
+	f.Add("https://a.com/x/**?q=*", "crud/read", `{}`, "https://A.com:443/x/../x/y?q=1", "crud/*", `{}`)
+	f.Add("as:did:key", "email/send", `1`, "my:", "", `{"pol":[["all",".x",["any",".",["not",["<",".",1]]]]]}`)
+
+	semantics := []Semantics{EmailSemantics, TypedEmailSemantics, WNFSSemantics, ProofDelegationSemantics, HTTPSemantics, CapabilitySemantics[URLScope, CrudAbility]{}}
+	f.Fuzz(func(t *testing.T, resource string, ability string, caveat string, otherResource string, otherAbility string, otherCaveat string) {
+		for _, sem := range semantics {
+			cv, err := sem.ParseCapability(&Capability{Resource: resource, Ability: ability, Caveat: caveat})
+			if err != nil {
+				continue
+			}
+			_ = cv.ToCapability()
+			_ = cv.CheckArguments([]byte(otherCaveat))
+			other, err := sem.ParseCapability(&Capability{Resource: otherResource, Ability: otherAbility, Caveat: otherCaveat})
+			if err != nil {
+				continue
+			}
+			_ = cv.Enables(other)
+			_ = other.Enables(cv)
+		}
+	})
+}
+
+func FuzzPolicies(f *testing.F) {
+	f.Add(`[["==", ".a", 1]]`, `[["<=", ".a", 2]]`, `{"a": 1}`)
+	f.Add(`[["like", ".to", "*@x\\*"]]`, `[["regex", ".to", "^a"]]`, `{"to": "a@x*"}`)
+	f.Add(`[["all", ".xs", ["in", ".", [1, 2]]]]`, `[["any", ".xs[-1]", ["==", ".", 1]]]`, `{"xs": [1, 2]}`)
+	f.Add(`[["or", [["not", ["==", ".[\"a.b\"]", null]]]]]`, `[["and", []]]`, `[]`)
+
+	f.Fuzz(func(t *testing.T, policy string, other string, doc string) {
+		p, err := ParsePolicy([]byte(policy))
+		if err != nil {
+			return
+		}
+		_ = p.String()
+		var value interface{}
+		if json.Unmarshal([]byte(doc), &value) == nil {
+			_ = p.Evaluate(value)
+		}
+		q, err := ParsePolicy([]byte(other))
+		if err != nil {
+			return
+		}
+		_ = p.Implies(q)
+		_ = q.Implies(p)
+	})
+}
@@ -0,0 +1,65 @@
+package capability
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// HTTPSemantics understands http and https resources with method abilities,
+// e.g. https://api.example.com/photos with http/get or http/*
+var HTTPSemantics = CapabilitySemantics[HTTPScope, HTTPAbility]{}
+
+var _ Semantics = HTTPSemantics
+
+var _ Scope = &HTTPScope{}
+
+// HTTPScope is an http or https URLScope, paths nest by prefix
+type HTTPScope struct {
+	URLScope
+}
+
+func (s HTTPScope) Contains(other Scope) bool {
+	otherScope, ok := other.(*HTTPScope)
+	if !ok {
+		return false
+	}
+	return s.URLScope.Contains(&otherScope.URLScope)
+}
+
+func (s HTTPScope) ParseScope(url url.URL) (Scope, error) {
+	if url.Scheme != "http" && url.Scheme != "https" {
+		return nil, fmt.Errorf("cannot interpret URI as http resource: %s", url.String())
+	}
+	if url.Opaque != "" || url.Host == "" {
+		return nil, fmt.Errorf("http resource without host: %s", url.String())
+	}
+	scope, err := ParseURLScope(url, s.mode)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPScope{*scope}, nil
+}
+
+var httpImplications = AbilityDAG{
+	"http/get": {"http/head"},
+}
+
+// HTTPMethods lets http/get enable http/head, other methods only enable themselves
+type HTTPMethods struct{}
+
+func (HTTPMethods) Implied(ability string) []string {
+	return httpImplications.Implied(ability)
+}
+
+func (HTTPMethods) Namespace() string {
+	return "http"
+}
+
+// HTTPAbility is the http namespace with one ability per lower cased method
+type HTTPAbility = NamespacedAbility[HTTPMethods]
+
+// HTTPMethodAbility returns the ability needed to send a request with method
+func HTTPMethodAbility(method string) string {
+	return "http/" + strings.ToLower(method)
+}
@@ -0,0 +1,40 @@
+package capability
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHTTPSemantics(t *testing.T) {
+	photos, err := HTTPSemantics.Parse("https://api.example.com/photos/", "http/*", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getPhoto, err := HTTPSemantics.Parse("https://api.example.com:443/photos/1?size=large", HTTPMethodAbility("GET"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headPhoto, err := HTTPSemantics.Parse("https://api.example.com/photos/1?size=large", HTTPMethodAbility("HEAD"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getUsers, err := HTTPSemantics.Parse("https://api.example.com/users", "http/get", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, photos.Enables(getPhoto))
+	assert.True(t, getPhoto.Enables(headPhoto))
+	assert.False(t, headPhoto.Enables(getPhoto))
+	assert.False(t, photos.Enables(getUsers))
+	assert.Equal(t, "https://api.example.com/photos/1?size=large", getPhoto.Resource.ToString())
+
+	for _, invalid := range [][2]string{
+		{"wnfs://alice/photos", "http/get"},
+		{"https:opaque", "http/get"},
+		{"https://api.example.com/photos", "crud/read"},
+	} {
+		_, err = HTTPSemantics.Parse(invalid[0], invalid[1], nil)
+		assert.ErrorContains(t, err, TypeParseError.Error(), invalid[0])
+	}
+}
@@ -0,0 +1,735 @@
+package capability
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PolicyCaveatKey is the caveat field holding policy statements, every other
+// field of a caveat is an equality constraint on the field of the same name.
+//
+// Statements are json arrays whose first element is the operator, selectors
+// are json paths such as ".", ".template", ".to[0]" or ".headers[\"x-id\"]":
+//
+//	{
+//	  "template": "newsletter",
+//	  "pol": [
+//	    ["<=", ".max_count", 5],
+//	    ["like", ".to", "*@example.com"],
+//	    ["regex", ".subject", "^(?i)weekly"],
+//	    ["in", ".lang", ["en", "fr"]],
+//	    ["all", ".attachments", ["<", ".size", 1048576]],
+//	    ["any", ".tags", ["==", ".", "public"]],
+//	    ["or", [["==", ".draft", true], ["not", ["==", ".urgent", true]]]]
+//	  ]
+//	}
+const PolicyCaveatKey = "pol"
+
+var PolicyParseError = fmt.Errorf("invalid policy")
+
+// Statement is a single predicate of a caveat policy
+type Statement interface {
+	// Evaluate reports whether the document satisfies the statement
+	Evaluate(doc interface{}) bool
+	// String returns the json form of the statement
+	String() string
+}
+
+// localStatement is a statement whose outcome only depends on the value found
+// at its selector, this lets implication compare statements on the same selector.
+type localStatement interface {
+	Statement
+	selector() Selector
+	matchValue(val interface{}, present bool) bool
+}
+
+// Policy is a conjunction of statements
+type Policy []Statement
+
+// Evaluate returns the first statement not satisfied by doc, or nil
+func (p Policy) Evaluate(doc interface{}) Statement {
+	for _, stmt := range p {
+		if !stmt.Evaluate(doc) {
+			return stmt
+		}
+	}
+	return nil
+}
+
+// Implies reports whether every document satisfying p also satisfies other,
+// that is p is at least as strict as other. The check is sound but not
+// complete: false may be returned for policies which actually imply other.
+func (p Policy) Implies(other Policy) bool {
+	all := &andStatement{stmts: p}
+	for _, stmt := range other {
+		if !implies(all, stmt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Policy) String() string {
+	parts := make([]string, 0, len(p))
+	for _, stmt := range p {
+		parts = append(parts, stmt.String())
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// ParsePolicy parses a json array of statements
+func ParsePolicy(data []byte) (Policy, error) {
+	var raw interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", PolicyParseError, err)
+	}
+	return parsePolicyValue(raw)
+}
+
+func parsePolicyValue(raw interface{}) (Policy, error) {
+	arr, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: policy must be an array of statements", PolicyParseError)
+	}
+	policy := make(Policy, 0, len(arr))
+	for _, rawStmt := range arr {
+		stmt, err := parseStatement(rawStmt)
+		if err != nil {
+			return nil, err
+		}
+		policy = append(policy, stmt)
+	}
+	return policy, nil
+}
+
+func parseStatement(raw interface{}) (Statement, error) {
+	arr, ok := raw.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, fmt.Errorf("%w: statement must be a non empty array, got %v", PolicyParseError, raw)
+	}
+	op, ok := arr[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: operator must be a string, got %v", PolicyParseError, arr[0])
+	}
+
+	switch op {
+	case "and", "or":
+		if len(arr) != 2 {
+			return nil, fmt.Errorf("%w: %s takes a list of statements", PolicyParseError, op)
+		}
+		stmts, err := parsePolicyValue(arr[1])
+		if err != nil {
+			return nil, err
+		}
+		if op == "and" {
+			return &andStatement{stmts: stmts}, nil
+		}
+		return &orStatement{stmts: stmts}, nil
+	case "not":
+		if len(arr) != 2 {
+			return nil, fmt.Errorf("%w: not takes a single statement", PolicyParseError)
+		}
+		stmt, err := parseStatement(arr[1])
+		if err != nil {
+			return nil, err
+		}
+		return &notStatement{stmt: stmt}, nil
+	}
+
+	if len(arr) != 3 {
+		return nil, fmt.Errorf("%w: %s takes a selector and an argument", PolicyParseError, op)
+	}
+	selStr, ok := arr[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: selector must be a string, got %v", PolicyParseError, arr[1])
+	}
+	sel, err := ParseSelector(selStr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "==", "!=":
+		return &comparisonStatement{op: op, sel: sel, value: arr[2]}, nil
+	case "<", "<=", ">", ">=":
+		if _, ok := arr[2].(float64); !ok {
+			return nil, fmt.Errorf("%w: %s only compares numbers, got %v", PolicyParseError, op, arr[2])
+		}
+		return &comparisonStatement{op: op, sel: sel, value: arr[2]}, nil
+	case "like":
+		pattern, ok := arr[2].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: like pattern must be a string, got %v", PolicyParseError, arr[2])
+		}
+		return &likeStatement{sel: sel, pattern: pattern}, nil
+	case "regex":
+		pattern, ok := arr[2].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: regex must be a string, got %v", PolicyParseError, arr[2])
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", PolicyParseError, err)
+		}
+		return &regexStatement{sel: sel, re: re}, nil
+	case "in":
+		values, ok := arr[2].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: in takes an array of values, got %v", PolicyParseError, arr[2])
+		}
+		return &inStatement{sel: sel, values: values}, nil
+	case "all", "any":
+		stmt, err := parseStatement(arr[2])
+		if err != nil {
+			return nil, err
+		}
+		return &quantifierStatement{op: op, sel: sel, stmt: stmt}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %s", PolicyParseError, op)
+	}
+}
+
+type comparisonStatement struct {
+	op    string
+	sel   Selector
+	value interface{}
+}
+
+func (s *comparisonStatement) Evaluate(doc interface{}) bool {
+	val, present := s.sel.Select(doc)
+	return s.matchValue(val, present)
+}
+
+func (s *comparisonStatement) selector() Selector {
+	return s.sel
+}
+
+func (s *comparisonStatement) matchValue(val interface{}, present bool) bool {
+	switch s.op {
+	case "==":
+		return present && reflect.DeepEqual(val, s.value)
+	case "!=":
+		return !present || !reflect.DeepEqual(val, s.value)
+	}
+
+	num, ok := val.(float64)
+	if !present || !ok {
+		return false
+	}
+	bound := s.value.(float64)
+	switch s.op {
+	case "<":
+		return num < bound
+	case "<=":
+		return num <= bound
+	case ">":
+		return num > bound
+	case ">=":
+		return num >= bound
+	default:
+		return false
+	}
+}
+
+func (s *comparisonStatement) String() string {
+	return statementString(s.op, s.sel.String(), s.value)
+}
+
+type likeStatement struct {
+	sel     Selector
+	pattern string
+}
+
+func (s *likeStatement) Evaluate(doc interface{}) bool {
+	val, present := s.sel.Select(doc)
+	return s.matchValue(val, present)
+}
+
+func (s *likeStatement) selector() Selector {
+	return s.sel
+}
+
+func (s *likeStatement) matchValue(val interface{}, present bool) bool {
+	str, ok := val.(string)
+	return present && ok && globMatch(s.pattern, str)
+}
+
+func (s *likeStatement) String() string {
+	return statementString("like", s.sel.String(), s.pattern)
+}
+
+type regexStatement struct {
+	sel Selector
+	re  *regexp.Regexp
+}
+
+func (s *regexStatement) Evaluate(doc interface{}) bool {
+	val, present := s.sel.Select(doc)
+	return s.matchValue(val, present)
+}
+
+func (s *regexStatement) selector() Selector {
+	return s.sel
+}
+
+func (s *regexStatement) matchValue(val interface{}, present bool) bool {
+	str, ok := val.(string)
+	return present && ok && s.re.MatchString(str)
+}
+
+func (s *regexStatement) String() string {
+	return statementString("regex", s.sel.String(), s.re.String())
+}
+
+type inStatement struct {
+	sel    Selector
+	values []interface{}
+}
+
+func (s *inStatement) Evaluate(doc interface{}) bool {
+	val, present := s.sel.Select(doc)
+	return s.matchValue(val, present)
+}
+
+func (s *inStatement) selector() Selector {
+	return s.sel
+}
+
+func (s *inStatement) matchValue(val interface{}, present bool) bool {
+	if !present {
+		return false
+	}
+	for _, v := range s.values {
+		if reflect.DeepEqual(val, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *inStatement) String() string {
+	return statementString("in", s.sel.String(), s.values)
+}
+
+type quantifierStatement struct {
+	op   string
+	sel  Selector
+	stmt Statement
+}
+
+func (s *quantifierStatement) Evaluate(doc interface{}) bool {
+	val, present := s.sel.Select(doc)
+	return s.matchValue(val, present)
+}
+
+func (s *quantifierStatement) selector() Selector {
+	return s.sel
+}
+
+func (s *quantifierStatement) matchValue(val interface{}, present bool) bool {
+	arr, ok := val.([]interface{})
+	if !present || !ok {
+		return false
+	}
+	for _, elem := range arr {
+		matched := s.stmt.Evaluate(elem)
+		if s.op == "all" && !matched {
+			return false
+		}
+		if s.op == "any" && matched {
+			return true
+		}
+	}
+	return s.op == "all"
+}
+
+func (s *quantifierStatement) String() string {
+	return statementString(s.op, s.sel.String(), json.RawMessage(s.stmt.String()))
+}
+
+type andStatement struct {
+	stmts []Statement
+}
+
+func (s *andStatement) Evaluate(doc interface{}) bool {
+	for _, stmt := range s.stmts {
+		if !stmt.Evaluate(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *andStatement) String() string {
+	return statementString("and", json.RawMessage(Policy(s.stmts).String()))
+}
+
+type orStatement struct {
+	stmts []Statement
+}
+
+func (s *orStatement) Evaluate(doc interface{}) bool {
+	for _, stmt := range s.stmts {
+		if stmt.Evaluate(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *orStatement) String() string {
+	return statementString("or", json.RawMessage(Policy(s.stmts).String()))
+}
+
+type notStatement struct {
+	stmt Statement
+}
+
+func (s *notStatement) Evaluate(doc interface{}) bool {
+	return !s.stmt.Evaluate(doc)
+}
+
+func (s *notStatement) String() string {
+	return statementString("not", json.RawMessage(s.stmt.String()))
+}
+
+func statementString(parts ...interface{}) string {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	// keep operators such as < readable in violation messages
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(parts)
+	if err != nil {
+		return fmt.Sprintf("%v", parts)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// implies reports whether t being satisfied guarantees s is satisfied
+func implies(t Statement, s Statement) bool {
+	if t.String() == s.String() {
+		return true
+	}
+
+	switch s := s.(type) {
+	case *andStatement:
+		for _, stmt := range s.stmts {
+			if !implies(t, stmt) {
+				return false
+			}
+		}
+		return true
+	case *orStatement:
+		for _, stmt := range s.stmts {
+			if implies(t, stmt) {
+				return true
+			}
+		}
+	}
+
+	switch t := t.(type) {
+	case *andStatement:
+		for _, stmt := range t.stmts {
+			if implies(stmt, s) {
+				return true
+			}
+		}
+		return false
+	case *orStatement:
+		if len(t.stmts) == 0 {
+			return false
+		}
+		for _, stmt := range t.stmts {
+			if !implies(stmt, s) {
+				return false
+			}
+		}
+		return true
+	case *notStatement:
+		// not a implies not b when b implies a
+		if s, ok := s.(*notStatement); ok {
+			return implies(s.stmt, t.stmt)
+		}
+		return false
+	}
+
+	tl, ok := t.(localStatement)
+	if !ok {
+		return false
+	}
+	sl, ok := asLocal(s)
+	if !ok || tl.selector().String() != sl.selector().String() {
+		return false
+	}
+
+	// t pins the selected value to a known set of values, so s can be checked on each of them
+	switch t := t.(type) {
+	case *comparisonStatement:
+		if t.op == "==" {
+			return sl.matchValue(t.value, true)
+		}
+	case *inStatement:
+		for _, v := range t.values {
+			if !sl.matchValue(v, true) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch t := t.(type) {
+	case *comparisonStatement:
+		if s, ok := s.(*comparisonStatement); ok {
+			return boundImplies(t, s)
+		}
+	case *likeStatement:
+		if s, ok := s.(*likeStatement); ok {
+			return s.pattern == "*" || s.pattern == t.pattern
+		}
+	case *quantifierStatement:
+		if s, ok := s.(*quantifierStatement); ok && s.op == t.op {
+			return implies(t.stmt, s.stmt)
+		}
+	}
+	return false
+}
+
+// asLocal treats the negation of a local statement as local on the same selector
+func asLocal(s Statement) (localStatement, bool) {
+	if not, ok := s.(*notStatement); ok {
+		inner, ok := not.stmt.(localStatement)
+		if !ok {
+			return nil, false
+		}
+		return &negatedStatement{inner}, true
+	}
+	local, ok := s.(localStatement)
+	return local, ok
+}
+
+type negatedStatement struct {
+	localStatement
+}
+
+func (s *negatedStatement) matchValue(val interface{}, present bool) bool {
+	return !s.localStatement.matchValue(val, present)
+}
+
+// boundImplies compares numeric bounds on the same selector
+func boundImplies(t *comparisonStatement, s *comparisonStatement) bool {
+	a, ok := t.value.(float64)
+	if !ok {
+		return false
+	}
+	b, ok := s.value.(float64)
+	if !ok {
+		return false
+	}
+	switch s.op {
+	case "<=":
+		return (t.op == "<=" || t.op == "<") && a <= b
+	case "<":
+		return (t.op == "<" && a <= b) || (t.op == "<=" && a < b)
+	case ">=":
+		return (t.op == ">=" || t.op == ">") && a >= b
+	case ">":
+		return (t.op == ">" && a >= b) || (t.op == ">=" && a > b)
+	default:
+		return false
+	}
+}
+
+// globMatch matches str against a pattern where * matches any sequence and \* a literal star
+func globMatch(pattern string, str string) bool {
+	tokens := make([]string, 0)
+	literal := strings.Builder{}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern) && pattern[i+1] == '*':
+			literal.WriteByte('*')
+			i++
+		case pattern[i] == '*':
+			tokens = append(tokens, literal.String(), "")
+			literal.Reset()
+		default:
+			literal.WriteByte(pattern[i])
+		}
+	}
+	tokens = append(tokens, literal.String())
+
+	// tokens alternate between literals and wildcards: lit (* lit)*
+	if !strings.HasPrefix(str, tokens[0]) {
+		return false
+	}
+	str = str[len(tokens[0]):]
+	if len(tokens) == 1 {
+		return str == ""
+	}
+	last := tokens[len(tokens)-1]
+	for i := 2; i < len(tokens)-1; i += 2 {
+		idx := strings.Index(str, tokens[i])
+		if idx < 0 {
+			return false
+		}
+		str = str[idx+len(tokens[i]):]
+	}
+	return strings.HasSuffix(str, last)
+}
+
+// Selector is a parsed json path, each segment is either a field name or an array index
+type Selector []selectorSegment
+
+type selectorSegment struct {
+	field   string
+	index   int
+	isIndex bool
+}
+
+func fieldSelector(field string) Selector {
+	return Selector{{field: field}}
+}
+
+// ParseSelector parses paths such as ".", ".a.b", ".a[0]" and ".[\"a.b\"]"
+func ParseSelector(str string) (Selector, error) {
+	if !strings.HasPrefix(str, ".") {
+		return nil, fmt.Errorf("%w: selector must start with '.', got %q", PolicyParseError, str)
+	}
+	sel := Selector{}
+	pos := 1
+	for pos < len(str) {
+		switch str[pos] {
+		case '[':
+			end := strings.IndexByte(str[pos:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated [ in selector %q", PolicyParseError, str)
+			}
+			inner := str[pos+1 : pos+end]
+			if strings.HasPrefix(inner, `"`) {
+				// quoted fields may contain ], find the closing quote instead
+				field, rest, err := unquotePrefix(str[pos+1:])
+				if err != nil || !strings.HasPrefix(rest, "]") {
+					return nil, fmt.Errorf("%w: invalid quoted field in selector %q", PolicyParseError, str)
+				}
+				sel = append(sel, selectorSegment{field: field})
+				pos = len(str) - len(rest) + 1
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid index %q in selector %q", PolicyParseError, inner, str)
+			}
+			sel = append(sel, selectorSegment{index: idx, isIndex: true})
+			pos += end + 1
+		case '.':
+			pos++
+		default:
+			end := strings.IndexAny(str[pos:], ".[")
+			if end < 0 {
+				end = len(str) - pos
+			}
+			sel = append(sel, selectorSegment{field: str[pos : pos+end]})
+			pos += end
+		}
+		if pos < len(str) && str[pos] == '.' && (pos+1 == len(str) || str[pos+1] == '.') {
+			return nil, fmt.Errorf("%w: empty field in selector %q", PolicyParseError, str)
+		}
+	}
+	return sel, nil
+}
+
+// unquotePrefix decodes the json string at the start of str and returns the rest
+func unquotePrefix(str string) (string, string, error) {
+	decoder := json.NewDecoder(strings.NewReader(str))
+	var field string
+	err := decoder.Decode(&field)
+	if err != nil {
+		return "", "", err
+	}
+	return field, str[decoder.InputOffset():], nil
+}
+
+// Select returns the value at the selector, negative indexes count from the end of arrays
+func (sel Selector) Select(doc interface{}) (interface{}, bool) {
+	current := doc
+	for _, seg := range sel {
+		if seg.isIndex {
+			arr, ok := current.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			idx := seg.index
+			if idx < 0 {
+				idx += len(arr)
+			}
+			if idx < 0 || idx >= len(arr) {
+				return nil, false
+			}
+			current = arr[idx]
+		} else {
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			val, ok := obj[seg.field]
+			if !ok {
+				return nil, false
+			}
+			current = val
+		}
+	}
+	return current, true
+}
+
+func (sel Selector) String() string {
+	if len(sel) == 0 {
+		return "."
+	}
+	builder := strings.Builder{}
+	for _, seg := range sel {
+		switch {
+		case seg.isIndex:
+			builder.WriteString("[" + strconv.Itoa(seg.index) + "]")
+		case seg.field == "" || strings.ContainsAny(seg.field, `.[]"`):
+			quoted, _ := json.Marshal(seg.field)
+			builder.WriteString("[" + string(quoted) + "]")
+		default:
+			builder.WriteString("." + seg.field)
+		}
+	}
+	str := builder.String()
+	if strings.HasPrefix(str, "[") {
+		str = "." + str
+	}
+	return str
+}
+
+// compilePolicy turns the caveat fields into a policy, plain fields become
+// equality statements and the PolicyCaveatKey field is parsed as statements.
+func compilePolicy(caveat map[string]interface{}) (Policy, error) {
+	keys := make([]string, 0, len(caveat))
+	for key := range caveat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	policy := make(Policy, 0, len(caveat))
+	for _, key := range keys {
+		if key == PolicyCaveatKey {
+			stmts, err := parsePolicyValue(caveat[key])
+			if err != nil {
+				return nil, err
+			}
+			policy = append(policy, stmts...)
+			continue
+		}
+		policy = append(policy, &comparisonStatement{op: "==", sel: fieldSelector(key), value: caveat[key]})
+	}
+	return policy, nil
+}
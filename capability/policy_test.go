@@ -0,0 +1,183 @@
+package capability
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func mustPolicy(t *testing.T, str string) Policy {
+	policy, err := ParsePolicy([]byte(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func mustDoc(t *testing.T, str string) interface{} {
+	var doc interface{}
+	err := json.Unmarshal([]byte(str), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestSelectors(t *testing.T) {
+	doc := mustDoc(t, `{"a": {"b": [1, {"c": "deep"}]}, "x.y": true}`)
+
+	cases := map[string]interface{}{
+		".":              doc,
+		".a.b[0]":        float64(1),
+		".a.b[-1].c":     "deep",
+		".a[\"b\"][1].c": "deep",
+		".[\"x.y\"]":     true,
+	}
+	for str, expected := range cases {
+		sel, err := ParseSelector(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, ok := sel.Select(doc)
+		assert.True(t, ok, str)
+		assert.Equal(t, expected, val, str)
+	}
+
+	sel, err := ParseSelector(".a.missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok := sel.Select(doc)
+	assert.False(t, ok)
+
+	for _, invalid := range []string{"", "a", ".a[", ".a[x]", ".a..b"} {
+		_, err = ParseSelector(invalid)
+		assert.ErrorIs(t, err, PolicyParseError, invalid)
+	}
+}
+
+func TestEvaluatesStatements(t *testing.T) {
+	doc := mustDoc(t, `{
+		"to": "bob@example.com",
+		"subject": "Weekly digest",
+		"count": 3,
+		"lang": "en",
+		"attachments": [{"size": 10}, {"size": 20}],
+		"tags": ["news", "public"],
+		"meta": {"draft": false}
+	}`)
+
+	cases := map[string]bool{
+		`[["==", ".count", 3]]`:                                   true,
+		`[["==", ".meta", {"draft": false}]]`:                     true,
+		`[["!=", ".lang", "fr"]]`:                                 true,
+		`[["<", ".count", 3]]`:                                    false,
+		`[["<=", ".count", 3]]`:                                   true,
+		`[[">", ".count", 2], [">=", ".count", 3]]`:               true,
+		`[["like", ".to", "*@example.com"]]`:                      true,
+		`[["like", ".to", "*@example.org"]]`:                      false,
+		`[["like", ".subject", "Weekly*"]]`:                       true,
+		`[["regex", ".subject", "^(?i)weekly"]]`:                  true,
+		`[["in", ".lang", ["en", "fr"]]]`:                         true,
+		`[["in", ".lang", ["de"]]]`:                               false,
+		`[["all", ".attachments", ["<", ".size", 20]]]`:           false,
+		`[["all", ".attachments", ["<=", ".size", 20]]]`:          true,
+		`[["any", ".tags", ["==", ".", "public"]]]`:               true,
+		`[["any", ".tags", ["==", ".", "private"]]]`:              false,
+		`[["or", [["==", ".lang", "fr"], ["==", ".count", 3]]]]`:  true,
+		`[["and", [["==", ".lang", "fr"], ["==", ".count", 3]]]]`: false,
+		`[["not", ["==", ".meta.draft", true]]]`:                  true,
+		`[["==", ".missing", null]]`:                              false,
+	}
+	for str, expected := range cases {
+		failed := mustPolicy(t, str).Evaluate(doc)
+		assert.Equal(t, expected, failed == nil, str)
+	}
+}
+
+func TestRejectsMalformedPolicies(t *testing.T) {
+	for _, invalid := range []string{
+		`{}`,
+		`[["=="]]`,
+		`[["<", ".count", "3"]]`,
+		`[["regex", ".a", "("]]`,
+		`[["in", ".a", "x"]]`,
+		`[["nope", ".a", 1]]`,
+		`[["and", ["==", ".a", 1]]]`,
+	} {
+		_, err := ParsePolicy([]byte(invalid))
+		assert.ErrorIs(t, err, PolicyParseError, invalid)
+	}
+}
+
+func TestPolicyImplication(t *testing.T) {
+	cases := []struct {
+		stricter string
+		looser   string
+		implies  bool
+	}{
+		{`[["<=", ".n", 3]]`, `[["<=", ".n", 5]]`, true},
+		{`[["<=", ".n", 5]]`, `[["<=", ".n", 3]]`, false},
+		{`[["<", ".n", 5]]`, `[["<=", ".n", 5]]`, true},
+		{`[["<=", ".n", 5]]`, `[["<", ".n", 5]]`, false},
+		{`[[">", ".n", 1]]`, `[[">=", ".n", 1]]`, true},
+		{`[["==", ".n", 2]]`, `[["<", ".n", 5], [">", ".n", 1]]`, true},
+		{`[["in", ".t", ["a"]]]`, `[["in", ".t", ["a", "b"]]]`, true},
+		{`[["in", ".t", ["a", "c"]]]`, `[["in", ".t", ["a", "b"]]]`, false},
+		{`[["==", ".to", "bob@example.com"]]`, `[["like", ".to", "*@example.com"]]`, true},
+		{`[["like", ".to", "*@example.com"]]`, `[["like", ".to", "*"]]`, true},
+		{`[["like", ".to", "*"]]`, `[["like", ".to", "*@example.com"]]`, false},
+		{`[["==", ".a", 1], ["==", ".b", 2]]`, `[["==", ".b", 2]]`, true},
+		{`[["==", ".a", 1]]`, `[["or", [["==", ".a", 1], ["==", ".a", 2]]]]`, true},
+		{`[["or", [["==", ".a", 1], ["==", ".a", 2]]]]`, `[["in", ".a", [1, 2]]]`, true},
+		{`[["or", [["==", ".a", 1], ["==", ".a", 3]]]]`, `[["in", ".a", [1, 2]]]`, false},
+		{`[["==", ".a", 1]]`, `[["not", ["==", ".a", 2]]]`, true},
+		{`[["not", ["in", ".a", [1, 2]]]]`, `[["not", ["==", ".a", 1]]]`, true},
+		{`[["all", ".xs", ["<", ".", 3]]]`, `[["all", ".xs", ["<=", ".", 3]]]`, true},
+		{`[["==", ".xs", [1, 2]]]`, `[["all", ".xs", ["<", ".", 3]]]`, true},
+		{`[["any", ".xs", ["<", ".", 3]]]`, `[["all", ".xs", ["<", ".", 3]]]`, false},
+		// a different selector never implies anything
+		{`[["==", ".a", 1]]`, `[["==", ".b", 1]]`, false},
+		{`[]`, `[["==", ".a", 1]]`, false},
+		{`[["==", ".a", 1]]`, `[]`, true},
+	}
+	for _, c := range cases {
+		implied := mustPolicy(t, c.stricter).Implies(mustPolicy(t, c.looser))
+		assert.Equal(t, c.implies, implied, "%s => %s", c.stricter, c.looser)
+	}
+}
+
+func TestCaveatsAttenuateWithPolicies(t *testing.T) {
+	parent, err := EmailSemantics.Parse("mailto:bob@email.com", "email/send", []byte(`{"pol": [["<=", ".max_count", 10]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stricter, err := EmailSemantics.Parse("mailto:bob@email.com", "email/send", []byte(`{"template": "newsletter", "pol": [["<=", ".max_count", 5]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	looser, err := EmailSemantics.Parse("mailto:bob@email.com", "email/send", []byte(`{"pol": [["<=", ".max_count", 50]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := EmailSemantics.Parse("mailto:bob@email.com", "email/send", []byte(`{"opts": {"cc": ["alice@email.com"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, parent.Enables(stricter))
+	assert.False(t, parent.Enables(looser))
+	assert.False(t, stricter.Enables(parent))
+	// nested values are compared structurally
+	assert.True(t, nested.Enables(nested))
+}
+
+func TestGlobMatching(t *testing.T) {
+	assert.True(t, globMatch("*", ""))
+	assert.True(t, globMatch("a*b*c", "aXXbYYc"))
+	assert.True(t, globMatch("a**", "a"))
+	assert.False(t, globMatch("a*b*c", "aXXcYYb"))
+	assert.True(t, globMatch(`\*lit`, "*lit"))
+	assert.False(t, globMatch(`\*lit`, "xlit"))
+	assert.False(t, globMatch("abc", "abcd"))
+}
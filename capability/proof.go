@@ -15,31 +15,30 @@ type ProofSelection struct {
 func (p ProofSelection) ToString() string {
 	if p.Index == -1 {
 		return "prf:*"
-	} else {
-		if p.Index < -1 {
-			panic(fmt.Sprintf("invalid Index: %d", p.Index))
-		}
-		return fmt.Sprintf("prf:%d", p.Index)
 	}
+	return fmt.Sprintf("prf:%d", p.Index)
 }
 
 func (p ProofSelection) Contains(other Scope) bool {
 	if ps, ok := other.(*ProofSelection); ok {
 		return p.Index == ps.Index || p.Index == -1
-	} else {
-		panic(fmt.Sprintf("invalid comparing between ProofSelection and %T", other))
 	}
+	return false
 }
 
 func (p ProofSelection) ParseScope(url url.URL) (Scope, error) {
 	switch url.Scheme {
 	case "prf":
-		if url.Path == "*" {
+		selection := opaqueOrPath(&url)
+		if selection == "*" {
 			return &ProofSelection{-1}, nil
 		}
-		idx, err := strconv.Atoi(url.Path)
+		idx, err := strconv.Atoi(selection)
 		if err != nil {
-			panic(err.Error())
+			return nil, fmt.Errorf("invalid proof index %q: %v", selection, err)
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid proof index: %d", idx)
 		}
 		return &ProofSelection{idx}, nil
 	default:
@@ -54,15 +53,10 @@ type ProofAction struct {
 }
 
 func (p ProofAction) Compare(abi Ability) int {
-	if other, ok := abi.(*ProofAction); ok {
-		if p.str == other.str {
-			return 0
-		} else {
-			panic(fmt.Sprintf("Unsupported comparing between %#v and %#v", p, other))
-		}
+	if other, ok := abi.(*ProofAction); ok && p.str == other.str {
+		return 0
 	}
-	panic(fmt.Sprintf("comparing between different ability: %T and %T", p, abi))
-
+	return NotComparable
 }
 
 func (p ProofAction) ParseAbility(str string) (Ability, error) {
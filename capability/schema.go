@@ -0,0 +1,271 @@
+package capability
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/KenCloud-Tech/go-ucan-kc/util"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var InvalidSchemaError = fmt.Errorf("invalid capability schema")
+
+// CapabilitySchema declares the resources, abilities and caveats of a
+// semantics, for example in yaml:
+//
+//	scheme: docs
+//	paths: prefix
+//	abilities: [docs/read, docs/comment, docs/write]
+//	ordered: true
+//	caveats: [max_size, pol]
+type CapabilitySchema struct {
+	// Scheme is the uri scheme of the resources
+	Scheme string `json:"scheme" yaml:"scheme"`
+	// Paths is how resource paths nest, prefix by default
+	Paths PathMode `json:"paths,omitempty" yaml:"paths,omitempty"`
+	// Abilities are all abilities of the semantics
+	Abilities []string `json:"abilities" yaml:"abilities"`
+	// Ordered abilities are levels from weakest to strongest, like levelMap
+	Ordered bool `json:"ordered,omitempty" yaml:"ordered,omitempty"`
+	// Implies maps an ability to the abilities it enables, transitively
+	Implies map[string][]string `json:"implies,omitempty" yaml:"implies,omitempty"`
+	// Caveats are the allowed caveat fields, nil allows any field
+	Caveats []string `json:"caveats,omitempty" yaml:"caveats,omitempty"`
+}
+
+func (schema *CapabilitySchema) validate() error {
+	if schema.Scheme == "" || strings.ContainsAny(schema.Scheme, ":/") {
+		return fmt.Errorf("%w: invalid scheme %q", InvalidSchemaError, schema.Scheme)
+	}
+	switch schema.Paths {
+	case "":
+		schema.Paths = PrefixPaths
+	case PrefixPaths, ExactPaths, GlobPaths:
+	default:
+		return fmt.Errorf("%w: unknown path mode %s", InvalidSchemaError, schema.Paths)
+	}
+
+	if len(schema.Abilities) == 0 {
+		return fmt.Errorf("%w: no abilities", InvalidSchemaError)
+	}
+	known := make(map[string]bool, len(schema.Abilities))
+	for _, ability := range schema.Abilities {
+		if known[ability] {
+			return fmt.Errorf("%w: duplicated ability %s", InvalidSchemaError, ability)
+		}
+		if err := ValidateAbility(ability); err != nil || strings.Contains(ability, "*") {
+			return fmt.Errorf("%w: abilities must be concrete namespaced abilities, got %q", InvalidSchemaError, ability)
+		}
+		known[ability] = true
+	}
+	for ability, implied := range schema.Implies {
+		if !known[ability] {
+			return fmt.Errorf("%w: unknown ability %s", InvalidSchemaError, ability)
+		}
+		for _, other := range implied {
+			if !known[other] {
+				return fmt.Errorf("%w: unknown ability %s", InvalidSchemaError, other)
+			}
+		}
+	}
+	return nil
+}
+
+// SchemaSemantics is a Semantics generated from a CapabilitySchema
+type SchemaSemantics struct {
+	schema  CapabilitySchema
+	levels  map[string]int
+	caveats map[string]bool
+}
+
+var _ Semantics = &SchemaSemantics{}
+
+func NewSchemaSemantics(schema CapabilitySchema) (*SchemaSemantics, error) {
+	err := schema.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &SchemaSemantics{
+		schema: schema,
+		levels: make(map[string]int, len(schema.Abilities)),
+	}
+	for idx, ability := range schema.Abilities {
+		ss.levels[ability] = idx
+	}
+	if schema.Caveats != nil {
+		ss.caveats = make(map[string]bool, len(schema.Caveats))
+		for _, field := range schema.Caveats {
+			ss.caveats[field] = true
+		}
+	}
+	return ss, nil
+}
+
+var _ AbilityImplications = &SchemaSemantics{}
+
+// Implied returns the declared implications of ability, ordered abilities
+// also imply the level below them
+func (ss *SchemaSemantics) Implied(ability string) []string {
+	implied := ss.schema.Implies[ability]
+	if level, ok := ss.levels[ability]; ok && ss.schema.Ordered && level > 0 {
+		implied = append([]string{ss.schema.Abilities[level-1]}, implied...)
+	}
+	return implied
+}
+
+// LoadSchemaSemantics loads a schema in yaml or json, which is a subset of yaml
+func LoadSchemaSemantics(data []byte) (*SchemaSemantics, error) {
+	schema := CapabilitySchema{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidSchemaError, err)
+	}
+	return NewSchemaSemantics(schema)
+}
+
+func LoadSchemaSemanticsFile(path string) (*SchemaSemantics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadSchemaSemantics(data)
+}
+
+func (ss *SchemaSemantics) Schema() CapabilitySchema {
+	return ss.schema
+}
+
+func (ss *SchemaSemantics) Parse(resource string, ability string, caveat []byte) (*CapabilityView, error) {
+	cv, err := parseCapabilityView(resource, ability, caveat, ss.parseScope, ss.parseAbility)
+	if err != nil {
+		return nil, err
+	}
+	err = ss.checkCaveatFields(cv.Caveat)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+func (ss *SchemaSemantics) ParseCapability(cap *Capability) (*CapabilityView, error) {
+	caveat, err := util.CaveatBytes(cap.Caveat)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidCaveatError, err)
+	}
+	return ss.Parse(cap.Resource, cap.Ability, caveat)
+}
+
+func (ss *SchemaSemantics) parseScope(url url.URL) (Scope, error) {
+	return (&SchemaScope{semantics: ss}).ParseScope(url)
+}
+
+func (ss *SchemaSemantics) parseAbility(str string) (Ability, error) {
+	return (&SchemaAbility{semantics: ss}).ParseAbility(str)
+}
+
+func (ss *SchemaSemantics) checkCaveatFields(caveat []byte) error {
+	if ss.caveats == nil {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	err := json.Unmarshal(caveat, &fields)
+	if err != nil {
+		return fmt.Errorf("%w: %v", InvalidCaveatError, err)
+	}
+	for field := range fields {
+		if !ss.caveats[field] {
+			return fmt.Errorf("%w: field %s is not allowed for %s resources", InvalidCaveatError, field, ss.schema.Scheme)
+		}
+	}
+	return nil
+}
+
+var _ Scope = &SchemaScope{}
+
+// SchemaScope is a resource of a SchemaSemantics, either hierarchical like
+// scheme://host/path or opaque like scheme:value, see URLScope
+type SchemaScope struct {
+	semantics *SchemaSemantics
+	scope     *URLScope
+}
+
+func (s *SchemaScope) Contains(other Scope) bool {
+	otherScope, ok := other.(*SchemaScope)
+	if !ok || s.semantics == nil || otherScope.semantics == nil ||
+		s.semantics.schema.Scheme != otherScope.semantics.schema.Scheme {
+		return false
+	}
+	return s.scope.Contains(otherScope.scope)
+}
+
+func (s *SchemaScope) ParseScope(url url.URL) (Scope, error) {
+	if s.semantics == nil {
+		return nil, fmt.Errorf("schema scope without schema")
+	}
+	scheme := s.semantics.schema.Scheme
+	if url.Scheme != scheme {
+		return nil, fmt.Errorf("cannot interpret URI as %s resource: %s", scheme, url.String())
+	}
+	scope, err := ParseURLScope(url, s.semantics.schema.Paths)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaScope{semantics: s.semantics, scope: scope}, nil
+}
+
+func (s *SchemaScope) ToString() string {
+	if s.scope == nil {
+		return ""
+	}
+	return s.scope.ToString()
+}
+
+var _ Ability = &SchemaAbility{}
+
+// SchemaAbility is an ability of a SchemaSemantics
+type SchemaAbility struct {
+	semantics *SchemaSemantics
+	name      string
+}
+
+func (a *SchemaAbility) ParseAbility(str string) (Ability, error) {
+	if a.semantics == nil {
+		return nil, fmt.Errorf("schema ability without schema")
+	}
+	if _, ok := a.semantics.levels[str]; !ok && !a.semantics.matchesWildcard(str) {
+		return nil, fmt.Errorf("unknown %s ability: %s", a.semantics.schema.Scheme, str)
+	}
+	return &SchemaAbility{semantics: a.semantics, name: str}, nil
+}
+
+func (ss *SchemaSemantics) matchesWildcard(str string) bool {
+	if str != WildcardAbility && (!strings.HasSuffix(str, "/*") || ValidateAbility(str) != nil) {
+		return false
+	}
+	for _, ability := range ss.schema.Abilities {
+		if EnablesAbility(str, ability, nil) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *SchemaAbility) ToString() string {
+	return a.name
+}
+
+// Compare follows wildcards, declared implications and the order of ordered abilities
+func (a *SchemaAbility) Compare(abi Ability) int {
+	other, ok := abi.(*SchemaAbility)
+	if !ok || a.semantics == nil || other.semantics == nil ||
+		a.semantics.schema.Scheme != other.semantics.schema.Scheme {
+		return NotComparable
+	}
+	return CompareAbilities(a.name, other.name, a.semantics)
+}
@@ -0,0 +1,174 @@
+package capability
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const docsSchema = `
+scheme: docs
+paths: prefix
+abilities: [docs/read, docs/comment, docs/write]
+ordered: true
+caveats: [max_size, pol]
+`
+
+func mustSchemaView(t *testing.T, ss *SchemaSemantics, resource string, ability string) *CapabilityView {
+	cv, err := ss.Parse(resource, ability, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cv
+}
+
+func TestLoadsSchemaFromYamlAndJson(t *testing.T) {
+	fromYaml, err := LoadSchemaSemantics([]byte(docsSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJson, err := LoadSchemaSemantics([]byte(`{
+		"scheme": "docs",
+		"abilities": ["docs/read", "docs/comment", "docs/write"],
+		"ordered": true,
+		"caveats": ["max_size", "pol"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fromYaml.Schema(), fromJson.Schema())
+	assert.Equal(t, PrefixPaths, fromJson.Schema().Paths)
+
+	path := filepath.Join(t.TempDir(), "docs.yaml")
+	err = os.WriteFile(path, []byte(docsSchema), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := LoadSchemaSemanticsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fromYaml.Schema(), fromFile.Schema())
+}
+
+func TestRejectsInvalidSchemas(t *testing.T) {
+	for _, invalid := range []string{
+		`abilities: [a/b]`,
+		`{scheme: docs}`,
+		`{scheme: docs, abilities: [a, a]}`,
+		`{scheme: docs, abilities: [a], paths: fuzzy}`,
+		`{scheme: docs, abilities: [a], implies: {a: [b]}}`,
+		`{scheme: docs, abilities: [a], unknown: true}`,
+	} {
+		_, err := LoadSchemaSemantics([]byte(invalid))
+		assert.ErrorIs(t, err, InvalidSchemaError, invalid)
+	}
+}
+
+func TestSchemaPrefixPathsAndOrderedAbilities(t *testing.T) {
+	ss, err := LoadSchemaSemantics([]byte(docsSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTeam := mustSchemaView(t, ss, "docs://example.com/team/", "docs/write")
+	readSpec := mustSchemaView(t, ss, "docs://example.com/team/spec", "docs/read")
+	writeTeams := mustSchemaView(t, ss, "docs://example.com/teams", "docs/write")
+
+	assert.True(t, writeTeam.Enables(readSpec))
+	assert.False(t, readSpec.Enables(writeTeam))
+	assert.False(t, writeTeam.Enables(writeTeams))
+	assert.Equal(t, "docs://example.com/team", writeTeam.Resource.ToString())
+
+	_, err = ss.Parse("mailto:alice@email.com", "docs/read", nil)
+	assert.ErrorContains(t, err, TypeParseError.Error())
+	_, err = ss.Parse("docs://example.com/team", "docs/delete", nil)
+	assert.ErrorContains(t, err, TypeParseError.Error())
+
+	_, err = ss.Parse("docs://example.com/team", "docs/read", []byte(`{"max_size": 10}`))
+	assert.NoError(t, err)
+	_, err = ss.Parse("docs://example.com/team", "docs/read", []byte(`{"owner": "bob"}`))
+	assert.ErrorIs(t, err, InvalidCaveatError)
+}
+
+func TestSchemaGlobPathsAndImplications(t *testing.T) {
+	ss, err := NewSchemaSemantics(CapabilitySchema{
+		Scheme:    "bucket",
+		Paths:     GlobPaths,
+		Abilities: []string{"bucket/read", "bucket/list", "bucket/write"},
+		Implies: map[string][]string{
+			"bucket/write": {"bucket/read"},
+			"bucket/read":  {"bucket/list"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anyPhoto := mustSchemaView(t, ss, "bucket://photos/**/*.jpg", "bucket/write")
+	yearPhotos := mustSchemaView(t, ss, "bucket://photos/2023/*.jpg", "bucket/list")
+	onePhoto := mustSchemaView(t, ss, "bucket://photos/2023/06/cat.jpg", "bucket/read")
+	anything := mustSchemaView(t, ss, "bucket://photos/**", "bucket/read")
+	listAll := mustSchemaView(t, ss, "bucket://photos/**", "bucket/list")
+
+	assert.True(t, anyPhoto.Enables(yearPhotos))
+	assert.True(t, anyPhoto.Enables(onePhoto))
+	assert.False(t, yearPhotos.Enables(anyPhoto))
+	assert.False(t, yearPhotos.Enables(onePhoto))
+	assert.False(t, anyPhoto.Enables(anything))
+	// implications are transitive, but not reversed
+	assert.True(t, anything.Enables(listAll))
+	assert.False(t, listAll.Enables(anything))
+	assert.True(t, mustSchemaView(t, ss, "bucket://photos/**", "bucket/write").Enables(listAll))
+}
+
+func TestSchemaExactPaths(t *testing.T) {
+	ss, err := NewSchemaSemantics(CapabilitySchema{
+		Scheme:    "queue",
+		Paths:     ExactPaths,
+		Abilities: []string{"queue/publish"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orders := mustSchemaView(t, ss, "queue:orders", "queue/publish")
+	assert.True(t, orders.Enables(mustSchemaView(t, ss, "queue:orders", "queue/publish")))
+	assert.False(t, orders.Enables(mustSchemaView(t, ss, "queue:orders-eu", "queue/publish")))
+	assert.Equal(t, "queue:orders", orders.Resource.ToString())
+}
+
+func TestSchemaWildcardAbilities(t *testing.T) {
+	ss, err := LoadSchemaSemantics([]byte(docsSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := mustSchemaView(t, ss, "docs://example.com/", "*")
+	allDocs := mustSchemaView(t, ss, "docs://example.com/", "docs/*")
+	write := mustSchemaView(t, ss, "docs://example.com/team", "docs/write")
+
+	assert.True(t, all.Enables(allDocs))
+	assert.True(t, allDocs.Enables(write))
+	assert.False(t, write.Enables(allDocs))
+
+	_, err = ss.Parse("docs://example.com/", "mail/*", nil)
+	assert.ErrorContains(t, err, TypeParseError.Error())
+}
+
+func TestSchemaForUrlResources(t *testing.T) {
+	ss, err := LoadSchemaSemantics([]byte(`
+scheme: https
+paths: glob
+abilities: [http/get, http/post]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports := mustSchemaView(t, ss, "https://api.example.com/teams/*/reports/**?format=*", "http/get")
+	assert.True(t, reports.Enables(mustSchemaView(t, ss, "https://API.example.com:443/teams/a/reports/2023/q1?format=csv", "http/get")))
+	assert.False(t, reports.Enables(mustSchemaView(t, ss, "https://api.example.com/teams/a/reports/2023/q1", "http/get")))
+	assert.False(t, reports.Enables(mustSchemaView(t, ss, "https://api.example.com/teams/a/reports/../members?format=csv", "http/get")))
+}
@@ -23,9 +23,17 @@ type Scope interface {
 type Ability interface {
 	ParseAbility(str string) (Ability, error)
 	ToString() string
+	// Compare returns 1 when the ability enables abi, -1 when abi enables it,
+	// 0 when they are equal and NotComparable otherwise
 	Compare(abi Ability) int
 }
 
+// Semantics parses capabilities of the resources and abilities it understands,
+// capabilities of other semantics fail with TypeParseError
+type Semantics interface {
+	ParseCapability(cap *Capability) (*CapabilityView, error)
+}
+
 type ResourceUri struct {
 	isScope bool
 	scope   Scope
@@ -48,9 +56,24 @@ type CapabilityView struct {
 	Ability  Ability
 	// Caveat must be json bytes
 	Caveat []byte
+
+	// caveats is set by semantics comparing caveats themselves, nil uses caveat policies
+	caveats caveatSemantics
+}
+
+// caveatSemantics compares and enforces the caveats of views parsed by one semantics
+type caveatSemantics interface {
+	enables(caveat []byte, other []byte) bool
+	check(caveat []byte, args []byte) error
 }
 
 func (cv *CapabilityView) Enables(other *CapabilityView) bool {
+	if cv.caveats != nil {
+		return cv.Resource.Contains(&other.Resource) &&
+			cv.Ability.Compare(other.Ability) >= 0 &&
+			cv.caveats.enables(cv.Caveat, other.Caveat)
+	}
+
 	caveat, err := BuildCaveat(cv.Caveat)
 	if err != nil {
 		return false
@@ -65,6 +88,25 @@ func (cv *CapabilityView) Enables(other *CapabilityView) bool {
 		caveat.enables(&otherCaveat)
 }
 
+// Covers compares resources and abilities only, for requests whose arguments
+// are checked against the caveat with CheckArguments
+func (cv *CapabilityView) Covers(other *CapabilityView) bool {
+	return cv.Resource.Contains(&other.Resource) && cv.Ability.Compare(other.Ability) >= 0
+}
+
+// CheckArguments decides whether the caveat of the capability permits an
+// invocation with the given json arguments
+func (cv *CapabilityView) CheckArguments(args []byte) error {
+	if cv.caveats != nil {
+		return cv.caveats.check(cv.Caveat, args)
+	}
+	caveat, err := BuildCaveat(cv.Caveat)
+	if err != nil {
+		return err
+	}
+	return caveat.Check(args)
+}
+
 func (cv *CapabilityView) ToCapability() *Capability {
 	return &Capability{
 		Resource: cv.Resource.ToString(),
@@ -110,7 +152,7 @@ func (r *Resource) ToString() string {
 	case AS:
 		return fmt.Sprintf("as:%s:%s", r.Did, r.ResourceUri.ToString())
 	default:
-		panic(fmt.Sprintf("invalid resource type: %d", r.Type))
+		return fmt.Sprintf("%s:%s", r.Type.Name(), r.ResourceUri.ToString())
 	}
 }
 
@@ -128,7 +170,7 @@ func (r *Resource) Contains(other *Resource) bool {
 			return false
 		}
 	default:
-		panic(fmt.Sprintf("Unsupported Resource type: %s", r.Type.Name()))
+		return false
 	}
 }
 
@@ -148,17 +190,38 @@ var ProofDelegationSemantics = CapabilitySemantics[ProofSelection, ProofAction]{
 type CapabilitySemantics[S Scope, A Ability] struct {
 }
 
-func (cs CapabilitySemantics[S, A]) parseResource(resource *url.URL) (ResourceUri, error) {
+// scopeParser and abilityParser parse the resources and abilities of one semantics
+type scopeParser func(url url.URL) (Scope, error)
+type abilityParser func(str string) (Ability, error)
+
+func (cs CapabilitySemantics[S, A]) parseScope(url url.URL) (Scope, error) {
+	var scope S
+	sc, err := scope.ParseScope(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse resource:%s as %T, err: %v", url.String(), scope, err)
+	}
+	return sc, nil
+}
+
+func (cs CapabilitySemantics[S, A]) parseAbility(str string) (Ability, error) {
+	var abi A
+	capAbi, err := abi.ParseAbility(str)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ability:%s as %T, err: %v", str, abi, err)
+	}
+	return capAbi, nil
+}
+
+func parseResource(resource *url.URL, parseScope scopeParser) (ResourceUri, error) {
 	switch resource.Path {
 	case "*":
 		return ResourceUri{
 			isScope: false,
 		}, nil
 	default:
-		var scope S
-		sc, err := scope.ParseScope(*resource)
+		sc, err := parseScope(*resource)
 		if err != nil {
-			return ResourceUri{}, fmt.Errorf("%s : failed to parse resource:%s as %T, err: %v", TypeParseError, resource.String(), scope, err)
+			return ResourceUri{}, fmt.Errorf("%s : %v", TypeParseError, err)
 		}
 		return ResourceUri{
 			isScope: true,
@@ -167,7 +230,7 @@ func (cs CapabilitySemantics[S, A]) parseResource(resource *url.URL) (ResourceUr
 	}
 }
 
-func (cs CapabilitySemantics[S, A]) extractDid(path string) (string, string, error) {
+func extractDid(path string) (string, string, error) {
 	pathParts := strings.Split(path, ":")
 	if len(pathParts) < 4 {
 		return "", "", fmt.Errorf("invalid parts length")
@@ -177,33 +240,34 @@ func (cs CapabilitySemantics[S, A]) extractDid(path string) (string, string, err
 		return "", "", fmt.Errorf("invalid did foramt: %s", path)
 	}
 
-	return strings.Join(pathParts[:3], ":"), strings.Join(pathParts[3:], ""), nil
+	return strings.Join(pathParts[:3], ":"), strings.Join(pathParts[3:], ":"), nil
 }
 
-func (cs CapabilitySemantics[S, A]) parseCaveat(caveat []byte) []byte {
-	//var jsonBytes []byte
-	//switch caveat.(type) {
-	//case string:
-	//	jsonBytes = []byte(caveat.(string))
-	//case []byte:
-	//	jsonBytes = caveat.([]byte)
-	//}
-	//if json.Valid(jsonBytes) {
-	//	return jsonBytes
-	//} else {
-	//	return NullJson
-	//}
+// opaqueOrPath returns the part of a my: or as: uri after its scheme
+func opaqueOrPath(uri *url.URL) string {
+	if uri.Opaque != "" {
+		return uri.Opaque
+	}
+	return uri.Path
+}
 
+func parseCaveat(caveat []byte) ([]byte, error) {
 	if caveat == nil || bytes.Equal(caveat, []byte("")) || bytes.Equal(caveat, NullJson) {
-		return NullJson
+		return NullJson, nil
 	}
 	if util.IsJsonObject(caveat) {
-		return caveat
+		return caveat, nil
 	}
-	panic(fmt.Sprintf("%s is not json object", caveat))
+	return nil, fmt.Errorf("%w: %s is not json object", InvalidCaveatError, caveat)
 }
 
 func (cs CapabilitySemantics[S, A]) Parse(resource string, ability string, caveat []byte) (*CapabilityView, error) {
+	return parseCapabilityView(resource, ability, caveat, cs.parseScope, cs.parseAbility)
+}
+
+// parseCapabilityView parses the my: and as: forms of resources around the
+// scopes and abilities of a semantics
+func parseCapabilityView(resource string, ability string, caveat []byte, parseScope scopeParser, parseAbility abilityParser) (*CapabilityView, error) {
 	uri, err := url.Parse(resource)
 	if err != nil {
 		return nil, err
@@ -213,12 +277,16 @@ func (cs CapabilitySemantics[S, A]) Parse(resource string, ability string, cavea
 	switch uri.Scheme {
 	case "my":
 		res.Type = My
-		res.ResourceUri, err = cs.parseResource(uri)
+		myUri, err := url.Parse(opaqueOrPath(uri))
+		if err != nil {
+			return nil, err
+		}
+		res.ResourceUri, err = parseResource(myUri, parseScope)
 		if err != nil {
 			return nil, err
 		}
 	case "as":
-		did, resource, err := cs.extractDid(uri.Path)
+		did, resource, err := extractDid(opaqueOrPath(uri))
 		if err != nil {
 			return nil, err
 		}
@@ -228,36 +296,39 @@ func (cs CapabilitySemantics[S, A]) Parse(resource string, ability string, cavea
 		if err != nil {
 			return nil, err
 		}
-		res.ResourceUri, err = cs.parseResource(didUri)
+		res.ResourceUri, err = parseResource(didUri, parseScope)
 		if err != nil {
 			return nil, err
 		}
 	default:
 		res.Type = DefaultResource
-		res.ResourceUri, err = cs.parseResource(uri)
+		res.ResourceUri, err = parseResource(uri, parseScope)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	var abi A
-	capAbi, err := abi.ParseAbility(ability)
+	capAbi, err := parseAbility(ability)
 	if err != nil {
-		return nil, fmt.Errorf("%s : failed to parse ability:%s as %T, err: %v", TypeParseError, ability, abi, err)
+		return nil, fmt.Errorf("%s : %v", TypeParseError, err)
 	}
 
-	//capCav, err := cs.parseCaveat(caveat)
-	//if err != nil {
-	//	return nil, err
-	//}
+	capCav, err := parseCaveat(caveat)
+	if err != nil {
+		return nil, err
+	}
 	cv := &CapabilityView{
 		Resource: *res,
 		Ability:  capAbi,
-		Caveat:   cs.parseCaveat(caveat),
+		Caveat:   capCav,
 	}
 	return cv, nil
 }
 
 func (cs CapabilitySemantics[S, A]) ParseCapability(cap *Capability) (*CapabilityView, error) {
-	return cs.Parse(cap.Resource, cap.Ability, util.CaveatBytes(cap.Caveat))
+	caveat, err := util.CaveatBytes(cap.Caveat)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidCaveatError, err)
+	}
+	return cs.Parse(cap.Resource, cap.Ability, caveat)
 }
@@ -0,0 +1,124 @@
+package capability
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/KenCloud-Tech/go-ucan-kc/util"
+)
+
+// TypedCaveat is implemented by the Go struct describing the caveats of a
+// semantics, values are encoded to and decoded from json objects automatically.
+type TypedCaveat[C any] interface {
+	// Narrows reports whether the caveat is at least as strict as other
+	Narrows(other C) bool
+	// Validate rejects decoded caveats which are not meaningful
+	Validate() error
+}
+
+// ArgumentChecker may be implemented by typed caveats to enforce themselves
+// against invocation arguments, otherwise their fields are checked like the
+// fields of untyped caveats.
+type ArgumentChecker interface {
+	CheckArguments(args []byte) error
+}
+
+// TypedCapabilitySemantics is a CapabilitySemantics whose caveats are decoded
+// into C and attenuated with C.Narrows instead of caveat policies.
+type TypedCapabilitySemantics[S Scope, A Ability, C TypedCaveat[C]] struct {
+}
+
+// NewCapability builds a capability from a typed caveat, the resource and
+// ability must be understood by the semantics.
+func (ts TypedCapabilitySemantics[S, A, C]) NewCapability(resource string, ability string, caveat C) (*Capability, error) {
+	err := caveat.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidCaveatError, err)
+	}
+	caveatBytes, err := json.Marshal(caveat)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidCaveatError, err)
+	}
+	if !util.IsJsonObject(caveatBytes) {
+		return nil, fmt.Errorf("%w: %T is not encoded as json object", InvalidCaveatError, caveat)
+	}
+
+	cv, err := ts.Parse(resource, ability, caveatBytes)
+	if err != nil {
+		return nil, err
+	}
+	return cv.ToCapability(), nil
+}
+
+func (ts TypedCapabilitySemantics[S, A, C]) Parse(resource string, ability string, caveat []byte) (*CapabilityView, error) {
+	cv, err := CapabilitySemantics[S, A]{}.Parse(resource, ability, caveat)
+	if err != nil {
+		return nil, err
+	}
+	_, err = decodeTypedCaveat[C](cv.Caveat)
+	if err != nil {
+		return nil, err
+	}
+	cv.caveats = typedCaveats[C]{}
+	return cv, nil
+}
+
+func (ts TypedCapabilitySemantics[S, A, C]) ParseCapability(cap *Capability) (*CapabilityView, error) {
+	caveat, err := util.CaveatBytes(cap.Caveat)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidCaveatError, err)
+	}
+	return ts.Parse(cap.Resource, cap.Ability, caveat)
+}
+
+// Caveat decodes the typed caveat of a view
+func (ts TypedCapabilitySemantics[S, A, C]) Caveat(cv *CapabilityView) (C, error) {
+	return decodeTypedCaveat[C](cv.Caveat)
+}
+
+func decodeTypedCaveat[C TypedCaveat[C]](caveat []byte) (C, error) {
+	var typed C
+	decoder := json.NewDecoder(bytes.NewReader(caveat))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&typed)
+	if err != nil {
+		// caveats of another shape belong to other semantics and are skipped
+		return typed, fmt.Errorf("%s : %v", TypeParseError, err)
+	}
+	err = typed.Validate()
+	if err != nil {
+		return typed, fmt.Errorf("%w: %v", InvalidCaveatError, err)
+	}
+	return typed, nil
+}
+
+var _ caveatSemantics = typedCaveats[EmailCaveat]{}
+
+type typedCaveats[C TypedCaveat[C]] struct{}
+
+func (typedCaveats[C]) enables(caveat []byte, other []byte) bool {
+	typed, err := decodeTypedCaveat[C](caveat)
+	if err != nil {
+		return false
+	}
+	otherTyped, err := decodeTypedCaveat[C](other)
+	if err != nil {
+		return false
+	}
+	return otherTyped.Narrows(typed)
+}
+
+func (typedCaveats[C]) check(caveat []byte, args []byte) error {
+	typed, err := decodeTypedCaveat[C](caveat)
+	if err != nil {
+		return err
+	}
+	if checker, ok := any(typed).(ArgumentChecker); ok {
+		return checker.CheckArguments(args)
+	}
+	untyped, err := BuildCaveat(caveat)
+	if err != nil {
+		return err
+	}
+	return untyped.Check(args)
+}
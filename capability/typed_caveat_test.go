@@ -0,0 +1,157 @@
+package capability_test
+
+import (
+	. "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTypedCaveatsRoundTrip(t *testing.T) {
+	caveat := capability.EmailCaveat{MaxCount: 5, Templates: []string{"newsletter"}}
+	cap, err := capability.TypedEmailSemantics.NewCapability("mailto:alice@email.com", "email/send", caveat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `{"max_count":5,"templates":["newsletter"]}`, cap.Caveat)
+
+	cv, err := capability.TypedEmailSemantics.ParseCapability(cap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := capability.TypedEmailSemantics.Caveat(cv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, caveat, decoded)
+}
+
+func TestRejectsInvalidTypedCaveats(t *testing.T) {
+	_, err := capability.TypedEmailSemantics.NewCapability("mailto:alice@email.com", "email/send", capability.EmailCaveat{MaxCount: -1})
+	assert.ErrorIs(t, err, capability.InvalidCaveatError)
+
+	_, err = capability.TypedEmailSemantics.Parse("mailto:alice@email.com", "email/send", []byte(`{"max_count": -1}`))
+	assert.ErrorIs(t, err, capability.InvalidCaveatError)
+
+	// caveats which do not decode are of other semantics
+	_, err = capability.TypedEmailSemantics.Parse("mailto:alice@email.com", "email/send", []byte(`{"max_count": "five"}`))
+	assert.ErrorContains(t, err, capability.TypeParseError.Error())
+
+	_, err = capability.TypedEmailSemantics.Parse("mailto:alice@email.com", "email/send", []byte(`{"unknown": 1}`))
+	assert.ErrorContains(t, err, capability.TypeParseError.Error())
+
+	_, err = capability.EmailSemantics.Parse("mailto:alice@email.com", "email/send", []byte(`[1]`))
+	assert.ErrorIs(t, err, capability.InvalidCaveatError)
+}
+
+func TestTypedCaveatsAttenuate(t *testing.T) {
+	parse := func(caveat capability.EmailCaveat) *capability.CapabilityView {
+		cap, err := capability.TypedEmailSemantics.NewCapability("mailto:alice@email.com", "email/send", caveat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cv, err := capability.TypedEmailSemantics.ParseCapability(cap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cv
+	}
+
+	unlimited := parse(capability.EmailCaveat{})
+	limited := parse(capability.EmailCaveat{MaxCount: 10, Templates: []string{"newsletter", "marketing"}})
+	stricter := parse(capability.EmailCaveat{MaxCount: 5, Templates: []string{"newsletter"}})
+
+	assert.True(t, unlimited.Enables(limited))
+	assert.True(t, limited.Enables(stricter))
+	assert.False(t, stricter.Enables(limited))
+	assert.False(t, limited.Enables(unlimited))
+
+	assert.NoError(t, stricter.CheckArguments([]byte(`{"max_count": 5, "template": "newsletter"}`)))
+	assert.ErrorIs(t, stricter.CheckArguments([]byte(`{"max_count": 6, "template": "newsletter"}`)), capability.CaveatViolationError)
+	assert.ErrorIs(t, stricter.CheckArguments([]byte(`{"max_count": 1, "template": "marketing"}`)), capability.CaveatViolationError)
+}
+
+func TestReducesChainsWithTypedCaveats(t *testing.T) {
+	store := NewMemoryStore()
+	delegated, err := capability.TypedEmailSemantics.NewCapability("mailto:alice@email.com", "email/send",
+		capability.EmailCaveat{MaxCount: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(delegated).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originatorsOf := func(caveat capability.EmailCaveat) map[string]bool {
+		claimed, err := capability.TypedEmailSemantics.NewCapability("mailto:alice@email.com", "email/send", caveat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ucan, err := DefaultBuilder().
+			IssuedBy(fixtures.TestIdentities.BobKey).
+			ForAudience(fixtures.TestIdentities.MalloryDidString).
+			WithLifetime(50).
+			WitnessedBy(leafUcan, nil).
+			ClaimingCapability(claimed).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc, err := ProofChainFromUcan(ucan, nil, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		capInfos, err := ReduceCapabilitiesWith(pc, capability.TypedEmailSemantics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, len(capInfos))
+		return capInfos[0].Originators
+	}
+
+	assert.Equal(t, map[string]bool{fixtures.TestIdentities.AliceDidString: true}, originatorsOf(capability.EmailCaveat{MaxCount: 5}))
+	// an escalated caveat is not backed by alice, so bob is its only originator
+	assert.Equal(t, map[string]bool{fixtures.TestIdentities.BobDidString: true}, originatorsOf(capability.EmailCaveat{MaxCount: 100}))
+}
+
+func TestSkipsCapabilitiesOfOtherCaveatShapes(t *testing.T) {
+	typed, err := capability.TypedEmailSemantics.NewCapability("mailto:alice@email.com", "email/send",
+		capability.EmailCaveat{MaxCount: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ucan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(typed).
+		ClaimingCapability(capability.NewCapability("mailto:alice@email.com", "email/send", []byte(`{"pol": [["==", ".to", "bob@email.com"]]}`))).
+		ClaimingCapability(capability.NewCapability("mailto:bob@email.com", "email/send", []byte(`{"max_count": "ten"}`))).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := ProofChainFromUcan(ucan, nil, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err := ReduceCapabilitiesWith(pc, capability.TypedEmailSemantics)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(capInfos))
+	assert.Equal(t, "mailto:alice@email.com", capInfos[0].Capability.Resource.ToString())
+	caveat, err := capability.TypedEmailSemantics.Caveat(&capInfos[0].Capability)
+	assert.NoError(t, err)
+	assert.Equal(t, capability.EmailCaveat{MaxCount: 10}, caveat)
+}
@@ -0,0 +1,275 @@
+package capability
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PathMode decides how the paths of url-like resources nest
+type PathMode string
+
+const (
+	// PrefixPaths scopes contain every path below them, segment by segment,
+	// with * and ** allowed as in globs
+	PrefixPaths PathMode = "prefix"
+	// ExactPaths scopes only contain themselves
+	ExactPaths PathMode = "exact"
+	// GlobPaths scopes are patterns where * matches within one segment and ** any number of segments
+	GlobPaths PathMode = "glob"
+)
+
+var _ Scope = &URLScope{}
+
+// defaultPorts are dropped from hosts, so https://example.com:443 and
+// https://example.com are the same resource
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// URLScope is a url-like resource such as https://example.com/photos or
+// s3://bucket/key with normalized, segment based paths. Its path mode decides
+// how paths nest:
+//   - PrefixPaths contain every path below them, * and ** may be used as in globs
+//   - GlobPaths contain the paths matched by them, * matches one segment and ** any number of segments
+//   - ExactPaths only contain themselves
+//
+// Query parameters are constraints, a scope contains urls carrying each of its
+// parameters with one of its values, where * matches any characters of a value.
+//
+// The zero value parses prefix scopes of any scheme.
+type URLScope struct {
+	mode     PathMode
+	scheme   string
+	host     string
+	segments []string
+	query    url.Values
+	opaque   string
+}
+
+// ParseURLScope parses uri as a URLScope whose paths nest according to mode
+func ParseURLScope(uri url.URL, mode PathMode) (*URLScope, error) {
+	switch mode {
+	case "":
+		mode = PrefixPaths
+	case PrefixPaths, ExactPaths, GlobPaths:
+	default:
+		return nil, fmt.Errorf("unknown path mode %s", mode)
+	}
+	if uri.Scheme == "" {
+		return nil, fmt.Errorf("missing scheme in %s", uri.String())
+	}
+	if uri.User != nil || uri.Fragment != "" {
+		return nil, fmt.Errorf("user info and fragments are not allowed in resource %s", uri.String())
+	}
+	query, err := url.ParseQuery(uri.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query in resource %s: %w", uri.String(), err)
+	}
+
+	scope := &URLScope{mode: mode, scheme: strings.ToLower(uri.Scheme), query: query}
+	if uri.Opaque != "" {
+		scope.opaque = uri.Opaque
+		return scope, nil
+	}
+	scope.host = strings.ToLower(uri.Host)
+	if port, ok := defaultPorts[scope.scheme]; ok {
+		scope.host = strings.TrimSuffix(scope.host, ":"+port)
+	}
+	scope.segments, err = NormalizePath(uri.EscapedPath())
+	if err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// NormalizePath splits an escaped url path into its unescaped segments,
+// dropping empty and . segments and resolving .. segments. Paths climbing
+// above their root are rejected, and so are escaped slashes and escaped . or
+// .. segments, which servers may decode into a different path.
+func NormalizePath(escapedPath string) ([]string, error) {
+	segments := make([]string, 0)
+	for _, seg := range strings.Split(escapedPath, "/") {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(segments) == 0 {
+				return nil, fmt.Errorf("path escapes its root: %s", escapedPath)
+			}
+			segments = segments[:len(segments)-1]
+		default:
+			unescaped, err := url.PathUnescape(seg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path segment %s: %w", seg, err)
+			}
+			if unescaped == "." || unescaped == ".." || strings.Contains(unescaped, "/") {
+				return nil, fmt.Errorf("escaped dot segment or slash in path: %s", escapedPath)
+			}
+			segments = append(segments, unescaped)
+		}
+	}
+	return segments, nil
+}
+
+func (s URLScope) Contains(other Scope) bool {
+	otherScope, ok := other.(*URLScope)
+	if !ok || s.scheme != otherScope.scheme || s.opaque != otherScope.opaque || s.host != otherScope.host {
+		return false
+	}
+	return s.containsPath(otherScope.segments) && queryContains(s.query, otherScope.query)
+}
+
+func (s URLScope) containsPath(other []string) bool {
+	switch s.mode {
+	case ExactPaths:
+		return len(s.segments) == len(other) && segmentsHavePrefix(other, s.segments)
+	case GlobPaths:
+		return globContains(s.segments, other)
+	default:
+		return globContains(append(s.segments[:len(s.segments):len(s.segments)], "**"), other)
+	}
+}
+
+// queryContains checks every constrained parameter of other only takes values allowed by query
+func queryContains(query url.Values, other url.Values) bool {
+	for key, allowed := range query {
+		values, ok := other[key]
+		if !ok || len(values) == 0 {
+			return false
+		}
+		for _, val := range values {
+			if !valueAllowed(allowed, val) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func valueAllowed(allowed []string, val string) bool {
+	for _, pattern := range allowed {
+		if segmentContains(pattern, val) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s URLScope) ParseScope(url url.URL) (Scope, error) {
+	return ParseURLScope(url, s.mode)
+}
+
+func (s URLScope) ToString() string {
+	var builder strings.Builder
+	builder.WriteString(s.scheme)
+	builder.WriteString(":")
+	if s.opaque != "" {
+		builder.WriteString(s.opaque)
+	} else {
+		builder.WriteString("//")
+		builder.WriteString(s.host)
+		builder.WriteString(s.Path())
+	}
+	if len(s.query) > 0 {
+		builder.WriteString("?")
+		builder.WriteString(encodeQuery(s.query))
+	}
+	return builder.String()
+}
+
+// Path returns the normalized, escaped path of the scope
+func (s URLScope) Path() string {
+	return joinSegments(s.segments)
+}
+
+// joinSegments escapes normalized segments back into an absolute path
+func joinSegments(segments []string) string {
+	escaped := make([]string, len(segments))
+	for idx, seg := range segments {
+		escaped[idx] = keepWildcards(url.PathEscape(seg))
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+// encodeQuery is url.Values.Encode keeping wildcards readable
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(query))
+	for _, key := range keys {
+		for _, val := range query[key] {
+			params = append(params, url.QueryEscape(key)+"="+keepWildcards(url.QueryEscape(val)))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func keepWildcards(escaped string) string {
+	return strings.ReplaceAll(escaped, "%2A", "*")
+}
+
+func pathSegments(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return []string{}
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func segmentsHavePrefix(segments []string, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for idx, seg := range prefix {
+		if segments[idx] != seg {
+			return false
+		}
+	}
+	return true
+}
+
+// globContains reports whether every path matched by the pattern other is
+// matched by pattern, * matches one segment and ** any number of segments.
+// It runs in len(pattern) * len(other) steps, so long paths in tokens can not
+// slow down verification.
+func globContains(pattern []string, other []string) bool {
+	// contained[i][j] reports whether pattern[i:] contains other[j:]
+	contained := make([][]bool, len(pattern)+1)
+	for i := range contained {
+		contained[i] = make([]bool, len(other)+1)
+	}
+	contained[len(pattern)][len(other)] = true
+	for i := len(pattern) - 1; i >= 0; i-- {
+		for j := len(other); j >= 0; j-- {
+			if pattern[i] == "**" {
+				// ** matches nothing, or other[j] and possibly more
+				contained[i][j] = contained[i+1][j] || (j < len(other) && contained[i][j+1])
+			} else {
+				contained[i][j] = j < len(other) && segmentContains(pattern[i], other[j]) && contained[i+1][j+1]
+			}
+		}
+	}
+	return contained[0][0]
+}
+
+// segmentContains matches single segments, * within a segment matches any characters
+func segmentContains(pattern string, other string) bool {
+	switch {
+	case other == "**":
+		return false
+	case pattern == other || pattern == "*":
+		return true
+	case strings.Contains(other, "*"):
+		// other is a pattern itself, only identical patterns are known to be contained
+		return false
+	default:
+		return globMatch(pattern, other)
+	}
+}
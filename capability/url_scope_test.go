@@ -0,0 +1,148 @@
+package capability
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func mustURLScope(t *testing.T, resource string, mode PathMode) *URLScope {
+	uri, err := url.Parse(resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope, err := ParseURLScope(*uri, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scope
+}
+
+func TestNormalizesURLScopes(t *testing.T) {
+	for resource, expected := range map[string]string{
+		"https://Example.COM:443/photos/":        "https://example.com/photos",
+		"https://example.com":                    "https://example.com/",
+		"s3://bucket//a/./b/../c":                "s3://bucket/a/c",
+		"file:///etc/passwd":                     "file:///etc/passwd",
+		"https://example.com/a%20b/**?tag=x&a=*": "https://example.com/a%20b/**?a=*&tag=x",
+		"urn:isbn:0451450523":                    "urn:isbn:0451450523",
+	} {
+		assert.Equal(t, expected, mustURLScope(t, resource, PrefixPaths).ToString(), resource)
+	}
+
+	for _, invalid := range []string{
+		"https://example.com/../etc", "https://user@example.com/", "https://example.com/#top", "/photos",
+		"http://example.com:8080/a%2Fb", "https://example.com/public/%2e%2e/admin", "https://example.com/a/%2E",
+	} {
+		uri, err := url.Parse(invalid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ParseURLScope(*uri, PrefixPaths)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestURLScopePrefixContainment(t *testing.T) {
+	photos := mustURLScope(t, "https://example.com/photos/", PrefixPaths)
+
+	assert.True(t, photos.Contains(mustURLScope(t, "https://example.com/photos", PrefixPaths)))
+	assert.True(t, photos.Contains(mustURLScope(t, "https://EXAMPLE.com/photos/2023/cat.jpg", PrefixPaths)))
+	assert.True(t, photos.Contains(mustURLScope(t, "https://example.com/photos/2023/../cat.jpg", PrefixPaths)))
+	assert.False(t, photos.Contains(mustURLScope(t, "https://example.com/photos2", PrefixPaths)))
+	assert.False(t, photos.Contains(mustURLScope(t, "https://example.com/photos/../secrets", PrefixPaths)))
+	assert.False(t, photos.Contains(mustURLScope(t, "http://example.com/photos", PrefixPaths)))
+	assert.False(t, photos.Contains(mustURLScope(t, "https://example.org/photos", PrefixPaths)))
+
+	userAlbums := mustURLScope(t, "https://example.com/users/*/albums", PrefixPaths)
+	assert.True(t, userAlbums.Contains(mustURLScope(t, "https://example.com/users/alice/albums/summer", PrefixPaths)))
+	assert.False(t, userAlbums.Contains(mustURLScope(t, "https://example.com/users/alice/profile", PrefixPaths)))
+	assert.False(t, userAlbums.Contains(mustURLScope(t, "https://example.com/users/*", PrefixPaths)))
+}
+
+func TestURLScopeGlobAndExactContainment(t *testing.T) {
+	jpgs := mustURLScope(t, "s3://bucket/**/*.jpg", GlobPaths)
+	assert.True(t, jpgs.Contains(mustURLScope(t, "s3://bucket/cat.jpg", GlobPaths)))
+	assert.True(t, jpgs.Contains(mustURLScope(t, "s3://bucket/2023/06/*.jpg", GlobPaths)))
+	assert.False(t, jpgs.Contains(mustURLScope(t, "s3://bucket/2023/cat.png", GlobPaths)))
+	assert.False(t, jpgs.Contains(mustURLScope(t, "s3://bucket/2023", GlobPaths)))
+
+	exact := mustURLScope(t, "s3://bucket/a/*", ExactPaths)
+	assert.True(t, exact.Contains(mustURLScope(t, "s3://bucket/a/*/", ExactPaths)))
+	assert.False(t, exact.Contains(mustURLScope(t, "s3://bucket/a/b", ExactPaths)))
+}
+
+func TestURLScopeQueryConstraints(t *testing.T) {
+	scope := mustURLScope(t, "https://api.example.com/search?region=eu&region=us&lang=*", PrefixPaths)
+
+	assert.True(t, scope.Contains(mustURLScope(t, "https://api.example.com/search?region=eu&lang=de", PrefixPaths)))
+	assert.True(t, scope.Contains(mustURLScope(t, "https://api.example.com/search/v2?lang=de&region=us&page=2", PrefixPaths)))
+	assert.False(t, scope.Contains(mustURLScope(t, "https://api.example.com/search?region=eu", PrefixPaths)))
+	assert.False(t, scope.Contains(mustURLScope(t, "https://api.example.com/search?region=eu&region=cn&lang=de", PrefixPaths)))
+	assert.False(t, scope.Contains(mustURLScope(t, "https://api.example.com/search?region=*&lang=de", PrefixPaths)))
+}
+
+func TestGlobContainmentOfLongPaths(t *testing.T) {
+	pattern := strings.Split(strings.Repeat("**/a/", 40)+"b", "/")
+	other := strings.Split(strings.Repeat("a/", 200)+"c", "/")
+	assert.False(t, globContains(pattern, other))
+}
+
+func TestWNFSScopesAreNormalized(t *testing.T) {
+	photos, err := WNFSSemantics.Parse("wnfs://alice.fission.name/public/photos/", "wnfs/create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cat, err := WNFSSemantics.Parse("wnfs://alice.fission.name/public/photos/cat.jpg", "wnfs/create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photos2, err := WNFSSemantics.Parse("wnfs://alice.fission.name/public/photos2", "wnfs/create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	escaping, err := WNFSSemantics.Parse("wnfs://alice.fission.name/public/photos/../private", "wnfs/create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, photos.Enables(cat))
+	assert.False(t, photos.Enables(photos2))
+	assert.False(t, photos.Enables(escaping))
+	assert.Equal(t, "wnfs://alice.fission.name/public/private", escaping.Resource.ToString())
+}
+
+func TestURLScopeWithGenericSemantics(t *testing.T) {
+	semantics := CapabilitySemantics[URLScope, CrudAbility]{}
+	bucket, err := semantics.Parse("s3://bucket/teams/a", "crud/*", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := semantics.Parse("s3://bucket/teams/a/report.csv", "crud/read", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, bucket.Enables(object))
+	assert.False(t, object.Enables(bucket))
+}
+
+func TestRejectsEncodedTraversal(t *testing.T) {
+	public, err := HTTPSemantics.Parse("https://api.example.com/public", "http/get", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photos, err := HTTPSemantics.Parse("https://api.example.com/public/photos", "http/get", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, public.Enables(photos))
+	for _, traversal := range []string{
+		"https://api.example.com/public/%2e%2e/admin",
+		"https://api.example.com/public/%2E%2e/admin",
+		"https://api.example.com/public%2F..%2Fadmin",
+	} {
+		_, err = HTTPSemantics.Parse(traversal, "http/get", nil)
+		assert.Error(t, err, traversal)
+	}
+}
@@ -0,0 +1,207 @@
+// Package car bundles ucans and their proofs into CAR files, so a complete
+// delegation can be handed to offline verifiers. The leaf ucan is the root of
+// the CAR and every ucan is a raw block under its own cid.
+package car
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/ipfs/go-cid"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/storage"
+	"io"
+)
+
+// MaxSectionSize bounds the size of a single ucan read from a CAR
+const MaxSectionSize = 1 << 20
+
+// WriterAt is needed to write CARv2 files, whose header is written last
+type WriterAt interface {
+	io.Writer
+	io.WriterAt
+}
+
+// Writer streams ucans into a CAR, duplicate ucans are written once
+type Writer struct {
+	car     storage.WritableCar
+	v2      bool
+	partial bool
+}
+
+// NewWriter writes a CARv1 to dst, blocks are streamed as they are put
+func NewWriter(dst io.Writer, root cid.Cid) (*Writer, error) {
+	wc, err := storage.NewWritable(dst, []cid.Cid{root}, carv2.WriteAsCarV1(true))
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{car: wc}, nil
+}
+
+// NewWriterV2 writes an indexed CARv2 to dst, which is complete after Close
+func NewWriterV2(dst WriterAt, root cid.Cid) (*Writer, error) {
+	wc, err := storage.NewWritable(dst, []cid.Cid{root})
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{car: wc, v2: true}, nil
+}
+
+// Put writes ucanStr under c after checking that it matches c
+func (w *Writer) Put(c cid.Cid, ucanStr string) error {
+	err := ucan.VerifyUcanCid(c, ucanStr)
+	if err != nil {
+		return err
+	}
+	return w.car.Put(context.Background(), c.KeyString(), []byte(ucanStr))
+}
+
+// WithPartialChains makes PutFromStore leave out the proofs missing in the
+// store instead of failing, the ucans it is given must still be found
+func (w *Writer) WithPartialChains() *Writer {
+	w.partial = true
+	return w
+}
+
+// PutProofChain writes the ucan of pc under c and the ucans of its proofs
+// under the cids of its prf field
+func (w *Writer) PutProofChain(c cid.Cid, pc *ucan.ProofChain) error {
+	ucanStr, err := pc.Ucan().EncodeSigned()
+	if err != nil {
+		return err
+	}
+	err = w.Put(c, ucanStr)
+	if err != nil {
+		return err
+	}
+	prfs := pc.Ucan().Proofs()
+	if len(prfs) != len(pc.Proofs()) {
+		return fmt.Errorf("proof chain of %s has %d proofs instead of %d", c.String(), len(pc.Proofs()), len(prfs))
+	}
+	for i, prf := range pc.Proofs() {
+		prfCid, err := cid.Decode(prfs[i])
+		if err != nil {
+			return err
+		}
+		err = w.PutProofChain(prfCid, prf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutFromStore copies the ucans of cids from store, with withProofs the proofs
+// they reference are copied too
+func (w *Writer) PutFromStore(ctx context.Context, store ucan.UcanStore, withProofs bool, cids ...cid.Cid) error {
+	cs := ucan.NewContextStore(store)
+	pending := append([]cid.Cid(nil), cids...)
+	seen := make(map[cid.Cid]bool)
+	for i := 0; len(pending) > 0; i++ {
+		c := pending[0]
+		pending = pending[1:]
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+
+		ucanStr, err := cs.ReadUcanStrContext(ctx, c)
+		if w.partial && i >= len(cids) && errors.Is(err, ucan.UcanNotFoundError) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = w.Put(c, ucanStr)
+		if err != nil {
+			return err
+		}
+		if !withProofs {
+			continue
+		}
+		uc, err := ucan.DecodeUcanString(ucanStr)
+		if err != nil {
+			return err
+		}
+		for _, prf := range uc.Proofs() {
+			prfCid, err := cid.Decode(prf)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, prfCid)
+		}
+	}
+	return nil
+}
+
+// Close completes a CARv2, it does not close the underlying writer
+func (w *Writer) Close() error {
+	if w.v2 {
+		return w.car.Finalize()
+	}
+	return nil
+}
+
+// ExportProofChain writes pc as CARv1 to dst with its ucan as root, the cid
+// of the root is returned
+func ExportProofChain(dst io.Writer, pc *ucan.ProofChain, prefix *cid.Prefix) (cid.Cid, error) {
+	if prefix == nil {
+		prefix = &ucan.DefaultPrefix
+	}
+	err := ucan.CheckPrefix(prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	ucanStr, err := pc.Ucan().EncodeSigned()
+	if err != nil {
+		return cid.Undef, err
+	}
+	root, err := prefix.Sum([]byte(ucanStr))
+	if err != nil {
+		return cid.Undef, err
+	}
+	w, err := NewWriter(dst, root)
+	if err != nil {
+		return cid.Undef, err
+	}
+	err = w.PutProofChain(root, pc)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return root, w.Close()
+}
+
+// Import reads a CARv1 or CARv2 block by block and writes every ucan into
+// store under its cid, the roots of the CAR are returned
+func Import(ctx context.Context, src io.Reader, store ucan.UcanStore) ([]cid.Cid, error) {
+	br, err := carv2.NewBlockReader(src, carv2.MaxAllowedSectionSize(MaxSectionSize))
+	if err != nil {
+		return nil, err
+	}
+	cs := ucan.NewContextStore(store)
+	for {
+		blk, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			return br.Roots, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c := blk.Cid()
+		ucanStr := string(blk.RawData())
+		err = ucan.VerifyUcanCid(c, ucanStr)
+		if err != nil {
+			return nil, err
+		}
+		prefix := c.Prefix()
+		written, err := cs.WriteUcanStrContext(ctx, ucanStr, &prefix)
+		if err != nil {
+			return nil, fmt.Errorf("importing %s: %w", c.String(), err)
+		}
+		if !written.Equals(c) {
+			return nil, fmt.Errorf("%w: store wrote %s instead of %s", ucan.UcanCidMismatchError, written.String(), c.String())
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	mb "github.com/multiformats/go-multibase"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// delegation lets alice delegate to bob who delegates to mallory, the proof
+// of bob is hashed with sha2-256
+func delegation(t *testing.T, store ucan.UcanStore) (*ucan.Ucan, cid.Cid) {
+	sha256Prefix := &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	grant, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(capability.NewCapability("mailto:alice@email.com", "email/send", capability.NullJson)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.WriteUcan(grant, sha256Prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		DelegatingFrom(grant, sha256Prefix).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := store.WriteUcan(leaf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf, c
+}
+
+func TestExportsProofChainsForOfflineVerification(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	leaf, leafCid := delegation(t, store)
+	pc, err := ucan.ProofChainFromUcan(leaf, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	root, err := ExportProofChain(&buf, pc, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, leafCid, root)
+
+	offline := ucan.NewMemoryStore()
+	roots, err := Import(context.Background(), &buf, offline)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{root}, roots)
+	assert.Equal(t, 2, offline.Len())
+	_, err = ucan.ProofChainFromUcanCid(roots[0], nil, offline)
+	assert.NoError(t, err)
+}
+
+func TestWritesIndexedCarV2FromStores(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	_, leafCid := delegation(t, store)
+
+	path := filepath.Join(t.TempDir(), "bundle.car")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriterV2(f, leafCid)
+	assert.NoError(t, err)
+	assert.NoError(t, w.PutFromStore(context.Background(), store, true, leafCid, leafCid))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	offline := ucan.NewMemoryStore()
+	roots, err := Import(context.Background(), f, offline)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{leafCid}, roots)
+	_, err = ucan.ProofChainFromUcanCid(leafCid, nil, offline)
+	assert.NoError(t, err)
+}
+
+func TestWritesPartialChains(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	leaf, leafCid := delegation(t, store)
+	leafStr, err := store.ReadUcanStr(leafCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := ucan.NewMemoryStore()
+	leafPrefix := leafCid.Prefix()
+	_, err = partial.WriteUcanStr(leafStr, &leafPrefix)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, leafCid)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, w.PutFromStore(context.Background(), partial, true, leafCid), ucan.UcanNotFoundError)
+
+	buf.Reset()
+	w, err = NewWriter(&buf, leafCid)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WithPartialChains().PutFromStore(context.Background(), partial, true, leafCid))
+	offline := ucan.NewMemoryStore()
+	_, err = Import(context.Background(), &buf, offline)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, offline.Len())
+
+	prfCid, err := cid.Decode(leaf.Proofs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, w.PutFromStore(context.Background(), partial, true, prfCid), ucan.UcanNotFoundError)
+}
+
+func TestRejectsTamperedBundles(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	leaf, leafCid := delegation(t, store)
+	leafStr, err := leaf.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, leafCid)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, w.Put(leafCid, leafStr+"x"), ucan.UcanCidMismatchError)
+	assert.NoError(t, w.Put(leafCid, leafStr))
+
+	// flip a character of the signature
+	tampered := strings.Replace(buf.String(), leafStr, leafStr[:len(leafStr)-1]+"A", 1)
+	if tampered == buf.String() {
+		tampered = strings.Replace(buf.String(), leafStr, leafStr[:len(leafStr)-1]+"B", 1)
+	}
+	_, err = Import(context.Background(), strings.NewReader(tampered), ucan.NewMemoryStore())
+	assert.Error(t, err)
+}
+
+func TestKeepsTheSignedEncoding(t *testing.T) {
+	built, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(capability.NewCapability("mailto:alice@email.com", "email/send", capability.NullJson)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sign an indented payload, which Encode would compact
+	header, err := built.Header.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadBytes, err := json.MarshalIndent(built.Payload, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := mb.Encode(mb.Base64url, payloadBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := fixtures.TestIdentities.AliceKey.Sign(header + "." + payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedSignature, err := mb.Encode(mb.Base64url, []byte(signature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := header + "." + payload + "." + encodedSignature
+	uc, err := ucan.DecodeUcanString(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencoded, err := uc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, signed, reencoded)
+
+	pc, err := ucan.ProofChainFromUcan(uc, nil, ucan.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	root, err := ExportProofChain(&buf, pc, nil)
+	assert.NoError(t, err)
+
+	offline := ucan.NewMemoryStore()
+	_, err = Import(context.Background(), &buf, offline)
+	assert.NoError(t, err)
+	str, err := offline.ReadUcanStr(root)
+	assert.NoError(t, err)
+	assert.Equal(t, signed, str)
+	_, err = ucan.ProofChainFromUcanCid(root, nil, offline)
+	assert.NoError(t, err)
+}
@@ -1,12 +1,14 @@
 package ucan
 
 import (
+	"context"
 	"fmt"
 	. "github.com/KenCloud-Tech/go-ucan-kc/capability"
 	"github.com/ipfs/go-cid"
 	"golang.org/x/exp/maps"
 
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,6 +17,8 @@ type CapabilityInfo struct {
 	NotBefore   *int64
 	Expires     *int64
 	Capability  CapabilityView
+	// Owner is the did owning the resource of a my: or as: capability
+	Owner string
 }
 
 type ProofChain struct {
@@ -23,6 +27,25 @@ type ProofChain struct {
 	redelegations map[int]bool
 }
 
+// Ucan returns the ucan at the head of the chain
+func (pc *ProofChain) Ucan() *Ucan {
+	return pc.ucan
+}
+
+// Proofs returns the chains of the proofs of the ucan, in the order of its prf field
+func (pc *ProofChain) Proofs() []*ProofChain {
+	return pc.proofs
+}
+
+// issuers returns the issuer of the chain's ucan and of all its ancestors
+func (pc *ProofChain) issuers() map[string]bool {
+	issuers := map[string]bool{pc.ucan.Issuer(): true}
+	for _, prf := range pc.proofs {
+		maps.Copy(issuers, prf.issuers())
+	}
+	return issuers
+}
+
 func (pc *ProofChain) ValidateLinkTo(uc *Ucan) error {
 	audience := pc.ucan.Audience()
 	issuer := uc.Issuer()
@@ -37,14 +60,18 @@ func (pc *ProofChain) ValidateLinkTo(uc *Ucan) error {
 }
 
 func ReduceCapabilities[S Scope, A Ability](pc *ProofChain) ([]*CapabilityInfo, error) {
-	cs := &CapabilitySemantics[S, A]{}
+	return ReduceCapabilitiesWith(pc, CapabilitySemantics[S, A]{})
+}
 
+// ReduceCapabilitiesWith reduces the capabilities of the chain understood by cs,
+// such as a TypedCapabilitySemantics comparing typed caveats.
+func ReduceCapabilitiesWith(pc *ProofChain, cs Semantics) ([]*CapabilityInfo, error) {
 	// get all ancestral CapabilityInfos(exclude delegated)
 	ancestralCapabilityInfos := make([]*CapabilityInfo, 0)
 	for idx, prf := range pc.proofs {
 		if _, exist := pc.redelegations[idx]; exist {
 		} else {
-			capInfos, err := ReduceCapabilities[S, A](prf)
+			capInfos, err := ReduceCapabilitiesWith(prf, cs)
 			if err != nil {
 				return nil, err
 			}
@@ -55,8 +82,7 @@ func ReduceCapabilities[S Scope, A Ability](pc *ProofChain) ([]*CapabilityInfo,
 	// get all delegated CapabilityInfos from ancestral
 	redelegatedCapabilityInfos := make([]*CapabilityInfo, 0)
 	for idx, _ := range pc.redelegations {
-		//capInfos, err := pc.proofs[idx].ReduceCapabilities(cs)
-		capInfos, err := ReduceCapabilities[S, A](pc.proofs[idx])
+		capInfos, err := ReduceCapabilitiesWith(pc.proofs[idx], cs)
 		if err != nil {
 			return nil, err
 		}
@@ -81,42 +107,39 @@ func ReduceCapabilities[S Scope, A Ability](pc *ProofChain) ([]*CapabilityInfo,
 	}
 
 	// get all CapabilityInfos in self caps and set the originators(may inherit from ancestral issuer if not the ori sets as self)
+	issuer := pc.ucan.Issuer()
 	selfCapabilityInfos := make([]*CapabilityInfo, 0)
-	if len(pc.proofs) == 0 {
-		for _, capView := range selfCapabilities {
-			capInfo := &CapabilityInfo{
-				Originators: map[string]bool{pc.ucan.Issuer(): true},
-				NotBefore:   pc.ucan.NotBefore(),
-				Expires:     pc.ucan.Expires(),
-				Capability:  *capView,
-			}
-			selfCapabilityInfos = append(selfCapabilityInfos, capInfo)
+	for _, capView := range selfCapabilities {
+		capInfo := &CapabilityInfo{
+			NotBefore:  pc.ucan.NotBefore(),
+			Expires:    pc.ucan.Expires(),
+			Capability: *capView,
 		}
-	} else {
-		for _, capView := range selfCapabilities {
-			originators := make(map[string]bool)
-			for _, ancestralCapabilityInfo := range ancestralCapabilityInfos {
-				if ancestralCapabilityInfo.Capability.Enables(capView) {
-					for ori, _ := range ancestralCapabilityInfo.Originators {
-						originators[ori] = true
-					}
-				} else {
-					continue
-				}
+		switch capView.Resource.Type {
+		case My:
+			// my: resources belong to the issuer, so the issuer is always the root of authority
+			capInfo.Originators = map[string]bool{issuer: true}
+			capInfo.Owner = issuer
+		case AS:
+			// as:<did>: resources are only valid when they originate from <did>
+			owner := capView.Resource.Did
+			originators := ancestralOriginators(ancestralCapabilityInfos, capView)
+			if owner == issuer {
+				originators[issuer] = true
 			}
-
-			if len(originators) == 0 {
-				originators[pc.ucan.Issuer()] = true
+			if !originators[owner] {
+				continue
 			}
-
-			capInfo := &CapabilityInfo{
-				Originators: originators,
-				NotBefore:   pc.ucan.NotBefore(),
-				Expires:     pc.ucan.Expires(),
-				Capability:  *capView,
+			capInfo.Originators = originators
+			capInfo.Owner = owner
+		default:
+			originators := ancestralOriginators(ancestralCapabilityInfos, capView)
+			if len(originators) == 0 {
+				originators[issuer] = true
 			}
-			selfCapabilityInfos = append(selfCapabilityInfos, capInfo)
+			capInfo.Originators = originators
 		}
+		selfCapabilityInfos = append(selfCapabilityInfos, capInfo)
 	}
 
 	selfCapabilityInfos = append(selfCapabilityInfos, redelegatedCapabilityInfos...)
@@ -127,7 +150,8 @@ Merge:
 		capInfo := selfCapabilityInfos[len(selfCapabilityInfos)-1]
 		selfCapabilityInfos = selfCapabilityInfos[:len(selfCapabilityInfos)-1]
 		for _, remainCapInfo := range selfCapabilityInfos {
-			if remainCapInfo.Capability.Enables(&capInfo.Capability) {
+			// my: resources of different owners are different resources
+			if remainCapInfo.Owner == capInfo.Owner && remainCapInfo.Capability.Enables(&capInfo.Capability) {
 				maps.Copy(remainCapInfo.Originators, capInfo.Originators)
 				goto Merge
 			}
@@ -139,32 +163,253 @@ Merge:
 	}
 }
 
-func ProofChainFromUcan(uc *Ucan, nowTime *time.Time, store UcanStore) (*ProofChain, error) {
+// DefaultProofConcurrency bounds how many proofs are fetched and verified at
+// the same time while building a ProofChain.
+const DefaultProofConcurrency = 8
+
+// ProofChainBuilder resolves the proofs of a UCAN from a ContextUcanStore.
+// Sibling proofs are fetched and verified concurrently, so the latency of
+// building a chain follows its depth rather than its total number of tokens.
+type ProofChainBuilder struct {
+	store       ContextUcanStore
+	concurrency int
+	revocations []RevocationChecker
+	replayGuard *ReplayGuard
+}
+
+func NewProofChainBuilder(store ContextUcanStore) *ProofChainBuilder {
+	return &ProofChainBuilder{
+		store:       store,
+		concurrency: DefaultProofConcurrency,
+	}
+}
+
+// WithConcurrency sets the maximum number of proofs fetched and verified at once
+func (b *ProofChainBuilder) WithConcurrency(n int) *ProofChainBuilder {
+	if n < 1 {
+		n = 1
+	}
+	b.concurrency = n
+	return b
+}
+
+// WithRevocationStore makes the builder reject revoked ucans, together with every ucan depending on them
+func (b *ProofChainBuilder) WithRevocationStore(revocations RevocationStore) *ProofChainBuilder {
+	return b.WithRevocationChecker(NewRevocationStoreChecker(revocations))
+}
+
+// WithRevocationChecker adds a checker consulted for every ucan of the chain
+func (b *ProofChainBuilder) WithRevocationChecker(checker RevocationChecker) *ProofChainBuilder {
+	b.revocations = append(b.revocations, checker)
+	return b
+}
+
+// WithReplayGuard makes the builder accept the root ucan of a chain only once,
+// its proofs may still be used by any number of chains.
+func (b *ProofChainBuilder) WithReplayGuard(guard *ReplayGuard) *ProofChainBuilder {
+	b.replayGuard = guard
+	return b
+}
+
+func (b *ProofChainBuilder) FromUcan(ctx context.Context, uc *Ucan, nowTime *time.Time) (*ProofChain, error) {
+	return b.build(ctx, uc, cid.Undef, nowTime)
+}
+
+func (b *ProofChainBuilder) build(ctx context.Context, uc *Ucan, c cid.Cid, nowTime *time.Time) (*ProofChain, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	err := uc.Validate(nowTime)
 	if err != nil {
 		return nil, err
 	}
-	proofs := make([]*ProofChain, 0)
-	for _, cidStr := range uc.Proofs() {
-		c, err := cid.Decode(cidStr)
+	r := &proofResolver{
+		builder: b,
+		nowTime: nowTime,
+		slots:   make(chan struct{}, b.concurrency),
+	}
+	pc, err := r.resolve(ctx, uc, c)
+	if err != nil {
+		return nil, err
+	}
+	if b.replayGuard != nil {
+		err = b.replayGuard.Check(uc)
 		if err != nil {
 			return nil, err
 		}
-		ucanStr, err := store.ReadUcanStr(c)
-		if err != nil {
-			return nil, err
+	}
+	return pc, nil
+}
+
+func (b *ProofChainBuilder) FromUcanStr(ctx context.Context, ucanStr string, nowTime *time.Time) (*ProofChain, error) {
+	ucan, err := DecodeUcanString(ucanStr)
+	if err != nil {
+		return nil, err
+	}
+	return b.FromUcan(ctx, ucan, nowTime)
+}
+
+func (b *ProofChainBuilder) FromUcanCid(ctx context.Context, c cid.Cid, nowTime *time.Time) (*ProofChain, error) {
+	ucanStr, err := b.store.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	err = VerifyUcanCid(c, ucanStr)
+	if err != nil {
+		return nil, err
+	}
+	ucan, err := DecodeUcanString(ucanStr)
+	if err != nil {
+		return nil, err
+	}
+	return b.build(ctx, ucan, c, nowTime)
+}
+
+// proofResolver holds the state shared by a single chain build, slots is the
+// bounded worker pool shared by every level of the chain.
+type proofResolver struct {
+	builder *ProofChainBuilder
+	nowTime *time.Time
+	slots   chan struct{}
+}
+
+func (r *proofResolver) acquire(ctx context.Context) error {
+	select {
+	case r.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *proofResolver) release() {
+	<-r.slots
+}
+
+// resolve builds the chain of an already validated ucan, c may be undefined for the root ucan
+func (r *proofResolver) resolve(ctx context.Context, uc *Ucan, c cid.Cid) (*ProofChain, error) {
+	prfs := uc.Proofs()
+	proofs := make([]*ProofChain, len(prfs))
+
+	if len(prfs) > 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		var once sync.Once
+		var firstErr error
+		for i, cidStr := range prfs {
+			wg.Add(1)
+			go func(i int, cidStr string) {
+				defer wg.Done()
+				proofChain, err := r.resolveProof(ctx, cidStr)
+				if err == nil {
+					err = proofChain.ValidateLinkTo(uc)
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+				proofs[i] = proofChain
+			}(i, cidStr)
 		}
-		proofChain, err := ProofChainFromUcanStr(ucanStr, nowTime, store)
-		if err != nil {
-			return nil, err
+		wg.Wait()
+		if firstErr != nil {
+			return nil, firstErr
 		}
-		err = proofChain.ValidateLinkTo(uc)
-		if err != nil {
-			return nil, err
+	}
+
+	redelegations, err := parseRedelegations(uc, len(proofs))
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &ProofChain{
+		ucan:          uc,
+		proofs:        proofs,
+		redelegations: redelegations,
+	}
+	if err = r.checkRevoked(c, pc); err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// checkRevoked fails if any revocation checker reports the ucan as revoked by
+// its issuer or the issuer of one of its proofs. The ucan is looked up under c,
+// the cid it was addressed by, and under its canonical DefaultPrefix cid.
+func (r *proofResolver) checkRevoked(c cid.Cid, pc *ProofChain) error {
+	if len(r.builder.revocations) == 0 {
+		return nil
+	}
+	canonical, _, err := pc.ucan.ToCid(nil)
+	if err != nil {
+		return err
+	}
+	cids := []cid.Cid{canonical}
+	if c.Defined() && !c.Equals(canonical) {
+		cids = append(cids, c)
+	}
+
+	issuers := pc.issuers()
+	for _, checker := range r.builder.revocations {
+		for _, c := range cids {
+			revoked, err := checker.IsRevoked(c, issuers)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return fmt.Errorf("%w: %s", UcanRevokedError, c.String())
+			}
 		}
-		proofs = append(proofs, proofChain)
+	}
+	return nil
+}
+
+// resolveProof fetches and verifies a single proof while holding a worker slot,
+// the slot is released before descending into the proofs of the proof.
+func (r *proofResolver) resolveProof(ctx context.Context, cidStr string) (*ProofChain, error) {
+	c, err := cid.Decode(cidStr)
+	if err != nil {
+		return nil, err
 	}
 
+	if err = r.acquire(ctx); err != nil {
+		return nil, err
+	}
+	proof, err := r.fetchAndValidate(ctx, c)
+	r.release()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.resolve(ctx, proof, c)
+}
+
+func (r *proofResolver) fetchAndValidate(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	ucanStr, err := r.builder.store.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	err = VerifyUcanCid(c, ucanStr)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := DecodeUcanString(ucanStr)
+	if err != nil {
+		return nil, err
+	}
+	err = proof.Validate(r.nowTime)
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+func parseRedelegations(uc *Ucan, proofCount int) (map[int]bool, error) {
 	redelegations := make(map[int]bool, 0)
 	caps := uc.Capabilities().ToCapsArray()
 	for _, cap := range caps {
@@ -177,17 +422,17 @@ func ProofChainFromUcan(uc *Ucan, nowTime *time.Time, store UcanStore) (*ProofCh
 			}
 		} else {
 			scope := capView.Resource.ResourceUri.Scope()
-			proofSelection, ok := scope.(ProofSelection)
+			proofSelection, ok := scope.(*ProofSelection)
 			if !ok {
-				return nil, fmt.Errorf("%t is not ProofSelection type", scope)
+				return nil, fmt.Errorf("%T is not ProofSelection type", scope)
 			}
 			chosenIdx := proofSelection.Index
 			if chosenIdx == -1 {
-				for i := 0; i < len(proofs); i++ {
+				for i := 0; i < proofCount; i++ {
 					//redelegations = append(redelegations, i)
 					redelegations[i] = true
 				}
-			} else if 0 < chosenIdx && chosenIdx < len(proofs) {
+			} else if 0 <= chosenIdx && chosenIdx < proofCount {
 				//redelegations = append(redelegations, chosenIdx)
 				redelegations[chosenIdx] = true
 			} else {
@@ -195,26 +440,61 @@ func ProofChainFromUcan(uc *Ucan, nowTime *time.Time, store UcanStore) (*ProofCh
 			}
 		}
 	}
+	return redelegations, nil
+}
 
-	return &ProofChain{
-		ucan:          uc,
-		proofs:        proofs,
-		redelegations: redelegations,
-	}, nil
+// ancestralOriginators collects the originators of every ancestral capability enabling capView
+func ancestralOriginators(ancestralCapabilityInfos []*CapabilityInfo, capView *CapabilityView) map[string]bool {
+	originators := make(map[string]bool)
+	for _, ancestralCapabilityInfo := range ancestralCapabilityInfos {
+		ancestralCapability := ancestralCapabilityInfo.ownedCapability()
+		if ancestralCapability.Enables(capView) {
+			for ori, _ := range ancestralCapabilityInfo.Originators {
+				originators[ori] = true
+			}
+		}
+	}
+	return originators
 }
 
-func ProofChainFromUcanStr(ucanStr string, nowTime *time.Time, store UcanStore) (*ProofChain, error) {
-	ucan, err := DecodeUcanString(ucanStr)
-	if err != nil {
-		return nil, err
+// Permits decides whether the caveats of the capability allow an invocation
+// with the given json arguments, a capability.CaveatViolation names the failed clause.
+func (ci *CapabilityInfo) Permits(args []byte) error {
+	return ci.Capability.CheckArguments(args)
+}
+
+// ownedCapability resolves a my: capability to the as:<owner>: capability it
+// stands for once it has been delegated.
+func (ci *CapabilityInfo) ownedCapability() *CapabilityView {
+	if ci.Capability.Resource.Type != My || ci.Owner == "" {
+		return &ci.Capability
 	}
-	return ProofChainFromUcan(ucan, nowTime, store)
+	capView := ci.Capability
+	capView.Resource.Type = AS
+	capView.Resource.Did = ci.Owner
+	return &capView
+}
+
+func ProofChainFromUcan(uc *Ucan, nowTime *time.Time, store UcanStore) (*ProofChain, error) {
+	return ProofChainFromUcanContext(context.Background(), uc, nowTime, NewContextStore(store))
+}
+
+func ProofChainFromUcanStr(ucanStr string, nowTime *time.Time, store UcanStore) (*ProofChain, error) {
+	return ProofChainFromUcanStrContext(context.Background(), ucanStr, nowTime, NewContextStore(store))
 }
 
 func ProofChainFromUcanCid(c cid.Cid, nowTime *time.Time, store UcanStore) (*ProofChain, error) {
-	ucan, err := store.ReadUcan(c)
-	if err != nil {
-		return nil, err
-	}
-	return ProofChainFromUcan(ucan, nowTime, store)
+	return ProofChainFromUcanCidContext(context.Background(), c, nowTime, NewContextStore(store))
+}
+
+func ProofChainFromUcanContext(ctx context.Context, uc *Ucan, nowTime *time.Time, store ContextUcanStore) (*ProofChain, error) {
+	return NewProofChainBuilder(store).FromUcan(ctx, uc, nowTime)
+}
+
+func ProofChainFromUcanStrContext(ctx context.Context, ucanStr string, nowTime *time.Time, store ContextUcanStore) (*ProofChain, error) {
+	return NewProofChainBuilder(store).FromUcanStr(ctx, ucanStr, nowTime)
+}
+
+func ProofChainFromUcanCidContext(ctx context.Context, c cid.Cid, nowTime *time.Time, store ContextUcanStore) (*ProofChain, error) {
+	return NewProofChainBuilder(store).FromUcanCid(ctx, c, nowTime)
 }
@@ -1,9 +1,13 @@
 package ucan
 
 import (
+	"context"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
 	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/assert"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -226,3 +230,179 @@ func TestUseCustomTimestampToValidateUcan(t *testing.T) {
 	}
 	assert.Equal(t, err, UcanExpiredError)
 }
+
+// gatedStore announces every read on entered and holds it until a value is
+// sent on release, it records how many reads run at the same time
+type gatedStore struct {
+	*MemoryStore
+	entered chan struct{}
+	release chan struct{}
+
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func newGatedStore(reads int) *gatedStore {
+	return &gatedStore{
+		MemoryStore: NewMemoryStore(),
+		entered:     make(chan struct{}, reads),
+		release:     make(chan struct{}),
+	}
+}
+
+func (s *gatedStore) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	s.mu.Lock()
+	s.current++
+	if s.current > s.max {
+		s.max = s.current
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.current--
+		s.mu.Unlock()
+	}()
+
+	s.entered <- struct{}{}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return s.MemoryStore.ReadUcanStr(c)
+}
+
+// await fails the test when nothing arrives on ch, instead of hanging it
+func await[T any](t *testing.T, ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the chain builder")
+	}
+	var zero T
+	return zero
+}
+
+func buildWideUcan(t *testing.T, store UcanStore, width int) *Ucan {
+	builder := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50)
+	for i := 0; i < width; i++ {
+		leafUcan, err := DefaultBuilder().
+			IssuedBy(fixtures.TestIdentities.AliceKey).
+			ForAudience(fixtures.TestIdentities.BobDidString).
+			WithLifetime(60).
+			WithNonce().
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = store.WriteUcan(leafUcan, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.WitnessedBy(leafUcan, nil)
+	}
+	ucan, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ucan
+}
+
+func TestResolvesSiblingProofsConcurrently(t *testing.T) {
+	store := newGatedStore(4)
+	ucan := buildWideUcan(t, store, 4)
+
+	type result struct {
+		chain *ProofChain
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		chain, err := NewProofChainBuilder(store).WithConcurrency(2).FromUcan(context.Background(), ucan, nil)
+		done <- result{chain, err}
+	}()
+
+	// two proofs are read at the same time before any read completes
+	await(t, store.entered)
+	await(t, store.entered)
+	for i := 0; i < 4; i++ {
+		store.release <- struct{}{}
+	}
+	res := await(t, done)
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+
+	assert.Equal(t, 4, len(res.chain.proofs))
+	for _, prf := range res.chain.proofs {
+		assert.Equal(t, fixtures.TestIdentities.AliceDidString, prf.ucan.Issuer())
+	}
+	assert.Equal(t, 2, store.max)
+}
+
+func TestProofChainHonoursDeadline(t *testing.T) {
+	store := newGatedStore(2)
+	ucan := buildWideUcan(t, store, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// reads are never released, so only the deadline ends the build
+	_, err := ProofChainFromUcanContext(ctx, ucan, nil, store)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestProofChainHonoursCancellation(t *testing.T) {
+	store := NewMemoryStore()
+	ucan := buildWideUcan(t, store, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ProofChainFromUcanContext(ctx, ucan, nil, store)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRedelegatesTheFirstProof(t *testing.T) {
+	grant, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(capability.NewCapability("mailto:alice@email.com", "email/send", capability.NullJson)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// DelegatingFrom claims prf:0 for the first proof
+	redelegation, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		DelegatingFrom(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, redelegation.Capabilities(), "prf:0")
+
+	store := NewMemoryStore()
+	_, err = store.WriteUcan(grant, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := ProofChainFromUcan(redelegation, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capInfos, err := ReduceCapabilities[capability.EmailAddress, capability.EmailAction](pc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(capInfos))
+	assert.Equal(t, "mailto:alice@email.com", capInfos[0].Capability.Resource.ToString())
+	assert.Equal(t, map[string]bool{fixtures.TestIdentities.AliceDidString: true}, capInfos[0].Originators)
+	assert.Equal(t, redelegation.Expires(), capInfos[0].Expires)
+}
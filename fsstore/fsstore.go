@@ -0,0 +1,313 @@
+// Package fsstore keeps ucans in a directory, one file per token. Files are
+// sharded by the next to last two characters of their cid like flatfs, e.g.
+// <root>/ab/bafkr...abc.ucan, and contain the encoded token, so they can be
+// inspected with ordinary tools. An optional index file lists the issuer,
+// audience and expiry of every stored token.
+package fsstore
+
+import (
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/ipfs/go-cid"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Extension is the file extension of stored tokens
+	Extension = ".ucan"
+	// IndexFile is the name of the index in the root directory
+	IndexFile = "index.tsv"
+)
+
+var _ ucan.EnumerableUcanStore = &Store{}
+
+// Store writes tokens atomically, a token is either completely stored or not
+// at all, and checks them against their cid when read.
+type Store struct {
+	lk    sync.RWMutex
+	root  string
+	index bool
+}
+
+// Open uses dir as store, creating it when missing
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{root: dir}, nil
+}
+
+// WithIndex maintains the index file, one "<cid>\t<iss>\t<aud>\t<exp>" line
+// per token with an empty exp for tokens which never expire. Deletes append a
+// "-<cid>" tombstone line instead of rewriting the index, the last line of a
+// cid wins and RebuildIndex drops the tombstones.
+func (s *Store) WithIndex() *Store {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.index = true
+	return s
+}
+
+// Root returns the directory of the store
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Path returns the file of the token stored under c
+func (s *Store) Path(c cid.Cid) string {
+	key := c.String()
+	return filepath.Join(s.root, shard(key), key+Extension)
+}
+
+func (s *Store) ReadUcan(c cid.Cid) (*ucan.Ucan, error) {
+	str, err := s.ReadUcanStr(c)
+	if err != nil {
+		return nil, err
+	}
+	return ucan.DecodeUcanString(str)
+}
+
+func (s *Store) WriteUcan(uc *ucan.Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	c, str, err := uc.ToCid(prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, s.put(c, str, uc)
+}
+
+func (s *Store) ReadUcanStr(c cid.Cid) (string, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return s.readUcanStr(c)
+}
+
+func (s *Store) readUcanStr(c cid.Cid) (string, error) {
+	data, err := os.ReadFile(s.Path(c))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s", ucan.UcanNotFoundError, c.String())
+	}
+	if err != nil {
+		return "", err
+	}
+	err = ucan.VerifyUcanCid(c, string(data))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *Store) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
+	uc, err := ucan.DecodeUcanString(str)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if prefix == nil {
+		prefix = &ucan.DefaultPrefix
+	}
+	c, err := prefix.Sum([]byte(str))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, s.put(c, str, uc)
+}
+
+// Has reports whether a token is stored under c, without checking its content
+func (s *Store) Has(c cid.Cid) (bool, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	_, err := os.Stat(s.Path(c))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes the token stored under c, deleting a missing token is not an error
+func (s *Store) Delete(c cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	err := os.Remove(s.Path(c))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.index {
+		return s.appendIndex("-" + c.String() + "\n")
+	}
+	return nil
+}
+
+// List returns the cids of all stored tokens, files which are not named after
+// a cid are skipped
+func (s *Store) List() ([]cid.Cid, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return s.list()
+}
+
+func (s *Store) list() ([]cid.Cid, error) {
+	cids := make([]cid.Cid, 0)
+	shards, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+	for _, sh := range shards {
+		if !sh.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.root, sh.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), Extension)
+			if !ok || entry.IsDir() {
+				continue
+			}
+			c, err := cid.Decode(name)
+			if err != nil || shard(name) != sh.Name() {
+				continue
+			}
+			cids = append(cids, c)
+		}
+	}
+	return cids, nil
+}
+
+// RebuildIndex rewrites the index file from the stored tokens, writes and
+// deletes wait for it so their index lines are not lost
+func (s *Store) RebuildIndex() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	cids, err := s.list()
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 0, len(cids))
+	for _, c := range cids {
+		str, err := s.readUcanStr(c)
+		if err != nil {
+			return err
+		}
+		uc, err := ucan.DecodeUcanString(str)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, indexLine(c, uc))
+	}
+	return writeFileAtomic(filepath.Join(s.root, IndexFile), []byte(strings.Join(lines, "")))
+}
+
+func (s *Store) put(c cid.Cid, str string, uc *ucan.Ucan) error {
+	prefix := c.Prefix()
+	err := ucan.CheckPrefix(&prefix)
+	if err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	path := s.Path(c)
+	_, err = os.Stat(path)
+	exists := err == nil
+	if exists {
+		// content addressed, a stored token which matches c is the same,
+		// a truncated or tampered file is replaced
+		if _, err = s.readUcanStr(c); err == nil {
+			return nil
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(path, []byte(str))
+	if err != nil {
+		return err
+	}
+	if !s.index || exists {
+		return nil
+	}
+	return s.appendIndex(indexLine(c, uc))
+}
+
+func (s *Store) appendIndex(line string) error {
+	f, err := os.OpenFile(filepath.Join(s.root, IndexFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(line)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func indexLine(c cid.Cid, uc *ucan.Ucan) string {
+	exp := ""
+	if uc.Expires() != nil {
+		exp = strconv.FormatInt(*uc.Expires(), 10)
+	}
+	return c.String() + "\t" + uc.Issuer() + "\t" + uc.Audience() + "\t" + exp + "\n"
+}
+
+// shard returns the next to last two characters of key
+func shard(key string) string {
+	if len(key) < 3 {
+		return "__"
+	}
+	return key[len(key)-3 : len(key)-1]
+}
+
+// writeFileAtomic writes to a temporary file which is synced and renamed to
+// path, followed by a sync of the directory so the rename survives a crash
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,138 @@
+package fsstore
+
+import (
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func buildUcan(t *testing.T) *ucan.Ucan {
+	uc, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		WithNonce().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uc
+}
+
+func TestStoreSurvivesReopening(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc := buildUcan(t)
+	c, err := store.WriteUcan(uc, nil)
+	assert.NoError(t, err)
+	sha256Cid, err := store.WriteUcan(uc, &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1})
+	assert.NoError(t, err)
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := store.ReadUcan(c)
+	assert.NoError(t, err)
+	assert.Equal(t, uc, read)
+	_, err = store.ReadUcan(sha256Cid)
+	assert.NoError(t, err)
+
+	encoded, err := uc.Encode()
+	assert.NoError(t, err)
+	data, err := os.ReadFile(store.Path(c))
+	assert.NoError(t, err)
+	assert.Equal(t, encoded, string(data))
+
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []cid.Cid{c, sha256Cid}, cids)
+
+	assert.NoError(t, store.Delete(c))
+	assert.NoError(t, store.Delete(c))
+	has, err := store.Has(c)
+	assert.NoError(t, err)
+	assert.False(t, has)
+	_, err = store.ReadUcanStr(c)
+	assert.ErrorIs(t, err, ucan.UcanNotFoundError)
+}
+
+func TestDetectsTamperedFiles(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc := buildUcan(t)
+	c, err := store.WriteUcan(uc, nil)
+	assert.NoError(t, err)
+
+	other, err := buildUcan(t).Encode()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(store.Path(c), []byte(other), 0o644))
+	_, err = store.ReadUcanStr(c)
+	assert.ErrorIs(t, err, ucan.UcanCidMismatchError)
+
+	// writing the token again replaces the tampered file
+	_, err = store.WriteUcan(uc, nil)
+	assert.NoError(t, err)
+	read, err := store.ReadUcan(c)
+	assert.NoError(t, err)
+	assert.Equal(t, uc, read)
+}
+
+func TestMaintainsTheIndex(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = store.WithIndex()
+	a, err := store.WriteUcan(buildUcan(t), nil)
+	assert.NoError(t, err)
+	b, err := store.WriteUcan(buildUcan(t), nil)
+	assert.NoError(t, err)
+	_, err = store.WriteUcan(buildUcan(t), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Delete(b))
+
+	index := func() []string {
+		data, err := os.ReadFile(filepath.Join(store.Root(), IndexFile))
+		assert.NoError(t, err)
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	lines := index()
+	assert.Equal(t, 4, len(lines))
+	assert.Equal(t, "-"+b.String(), lines[3])
+	fields := strings.Split(lines[0], "\t")
+	assert.Equal(t, a.String(), fields[0])
+	assert.Equal(t, fixtures.TestIdentities.AliceDidString, fields[1])
+	assert.Equal(t, fixtures.TestIdentities.BobDidString, fields[2])
+
+	assert.NoError(t, store.RebuildIndex())
+	assert.ElementsMatch(t, []string{lines[0], lines[2]}, index())
+}
+
+func TestRejectsWeakPrefixes(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc := buildUcan(t)
+	_, err = store.WriteUcan(uc, &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.MURMUR3X64_64, MhLength: -1})
+	assert.ErrorIs(t, err, ucan.UnsupportedPrefixError)
+	str, err := uc.Encode()
+	assert.NoError(t, err)
+	_, err = store.WriteUcanStr(str, &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: 16})
+	assert.ErrorIs(t, err, ucan.UnsupportedPrefixError)
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.Empty(t, cids)
+}
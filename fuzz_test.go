@@ -0,0 +1,139 @@
+package ucan
+
+import (
+	"encoding/json"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	didkey "github.com/KenCloud-Tech/go-ucan-kc/key"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"testing"
+)
+
+var fuzzSemantics = []capability.Semantics{
+	capability.EmailSemantics,
+	capability.TypedEmailSemantics,
+	capability.WNFSSemantics,
+	capability.ProofDelegationSemantics,
+	capability.HTTPSemantics,
+}
+
+// resign replaces the capabilities of uc and signs it again, so fuzzed
+// capabilities get past signature verification into chain reduction
+func resign(t *testing.T, uc *Ucan, issuer didkey.KeyMaterial, caps capability.Capabilities) {
+	uc.Payload.Caps = caps
+	header, err := uc.Header.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := uc.Payload.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataToSign := header + "." + payload
+	signature, err := issuer.Sign(dataToSign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc.DataToSign = []byte(dataToSign)
+	uc.Signature = []byte(signature)
+}
+
+func reduceWithAllSemantics(pc *ProofChain) {
+	for _, sem := range fuzzSemantics {
+		capInfos, err := ReduceCapabilitiesWith(pc, sem)
+		if err != nil {
+			continue
+		}
+		for _, capInfo := range capInfos {
+			_ = capInfo.Permits([]byte(`{"max_count": 1}`))
+		}
+	}
+}
+
+func FuzzDecodeUcanString(f *testing.F) {
+	uc, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		WithFact("abc/challenge", `{"foo":"bar"}`).
+		ClaimingCapability(capability.NewCapability("mailto:alice@email.com", "email/send", []byte(`{"max_count":5}`))).
+		Build()
+	if err != nil {
+		f.Fatal(err)
+	}
+	ucStr, err := uc.Encode()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(ucStr)
+	f.Add("")
+	f.Add("..")
+	f.Add("a.b.c")
+	f.Add("ueyJ9.ueyJ9.u")
+
+	f.Fuzz(func(t *testing.T, ucStr string) {
+		uc, err := DecodeUcanString(ucStr)
+		if err != nil {
+			return
+		}
+		_ = uc.Validate(nil)
+		_, _, _ = uc.ToCid(nil)
+		for _, cap := range uc.Capabilities().ToCapsArray() {
+			for _, sem := range fuzzSemantics {
+				_, _ = sem.ParseCapability(&cap)
+			}
+		}
+		pc, err := ProofChainFromUcan(uc, nil, NewMemoryStore())
+		if err != nil {
+			return
+		}
+		reduceWithAllSemantics(pc)
+	})
+}
+
+func FuzzReduceCapabilities(f *testing.F) {
+	f.Add([]byte(`{"mailto:alice@email.com": {"email/send": [{}]}}`), []byte(`{"mailto:alice@email.com": {"email/send": [{}]}}`))
+	f.Add([]byte(`{"prf:0": {"ucan/DELEGATE": [{}]}}`), []byte(`{"wnfs://alice/photos": {"wnfs/create": [{}]}}`))
+	f.Add([]byte(`{"prf:*": {"ucan/DELEGATE": [1]}, "prf:x": {"ucan/DELEGATE": [{}]}}`), []byte(`{"my:*": {"email/send": [null]}}`))
+	f.Add([]byte(`{"mailto:alice@email.com": {"email/send": [{"pol": [["<=", ".max_count", 1]]}]}}`),
+		[]byte(`{"mailto:alice@email.com": {"email/send": [{"pol": [["like", ".to", "*"]], "max_count": "x"}]}}`))
+	f.Add([]byte(`{"as:did:key:z:mailto:a": {"*": [{}]}}`), []byte(`{"as:did:key:x": {"email/send": ["[]"]}}`))
+
+	f.Fuzz(func(t *testing.T, capsJson []byte, proofCapsJson []byte) {
+		var caps, proofCaps capability.Capabilities
+		if json.Unmarshal(capsJson, &caps) != nil || json.Unmarshal(proofCapsJson, &proofCaps) != nil {
+			return
+		}
+
+		store := NewMemoryStore()
+		proof, err := DefaultBuilder().
+			IssuedBy(fixtures.TestIdentities.AliceKey).
+			ForAudience(fixtures.TestIdentities.BobDidString).
+			WithLifetime(60).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resign(t, proof, fixtures.TestIdentities.AliceKey, proofCaps)
+		_, err = store.WriteUcan(proof, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		uc, err := DefaultBuilder().
+			IssuedBy(fixtures.TestIdentities.BobKey).
+			ForAudience(fixtures.TestIdentities.MalloryDidString).
+			WithLifetime(50).
+			WitnessedBy(proof, nil).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resign(t, uc, fixtures.TestIdentities.BobKey, caps)
+
+		pc, err := ProofChainFromUcan(uc, nil, store)
+		if err != nil {
+			return
+		}
+		reduceWithAllSemantics(pc)
+	})
+}
@@ -0,0 +1,215 @@
+package ucan
+
+import (
+	"context"
+	"errors"
+	"github.com/ipfs/go-cid"
+	"sync"
+	"time"
+)
+
+// EnumerableUcanStore can list and delete the ucans it holds
+type EnumerableUcanStore interface {
+	UcanStore
+	List() ([]cid.Cid, error)
+	Delete(c cid.Cid) error
+}
+
+var _ EnumerableUcanStore = &MemoryStore{}
+var _ EnumerableUcanStore = &TieredStore{}
+
+// peeker reads ucans without counting the read as a use, so a collection does
+// not refresh the recency of every ucan of a MemoryStore
+type peeker interface {
+	PeekUcanStr(c cid.Cid) (string, error)
+}
+
+// GCReport lists what a collection found, Deleted is empty for dry runs.
+// Unreadable ucans, e.g. which do not decode or match their cid, are skipped.
+type GCReport struct {
+	Scanned     int
+	Reachable   int
+	Expired     []cid.Cid
+	Unreachable []cid.Cid
+	Unreadable  []cid.Cid
+	Deleted     []cid.Cid
+	DryRun      bool
+}
+
+// GarbageCollector deletes the ucans of a store which are not reachable from
+// its roots through prf links, or whose exp has passed. With a grace period,
+// expired ucans are kept for the period after their exp and unreachable ucans
+// are only deleted once they were unreachable for the period, so ucans written
+// while a collection runs are not lost. The collector remembers since when
+// ucans are unreachable, reuse it for periodic collections.
+type GarbageCollector struct {
+	store  EnumerableUcanStore
+	roots  []cid.Cid
+	grace  time.Duration
+	dryRun bool
+	now    func() time.Time
+
+	lk          sync.Mutex
+	unreachable map[cid.Cid]time.Time
+}
+
+func NewGarbageCollector(store EnumerableUcanStore) *GarbageCollector {
+	return &GarbageCollector{
+		store:       store,
+		now:         time.Now,
+		unreachable: make(map[cid.Cid]time.Time),
+	}
+}
+
+// WithRoots adds ucans to keep together with their proofs, e.g. the ucans
+// held by the service or referenced by active sessions
+func (gc *GarbageCollector) WithRoots(roots ...cid.Cid) *GarbageCollector {
+	gc.roots = append(gc.roots, roots...)
+	return gc
+}
+
+// WithGracePeriod delays the deletion of expired and unreachable ucans
+func (gc *GarbageCollector) WithGracePeriod(grace time.Duration) *GarbageCollector {
+	gc.grace = grace
+	return gc
+}
+
+// DryRun only reports what a collection would delete
+func (gc *GarbageCollector) DryRun() *GarbageCollector {
+	gc.dryRun = true
+	return gc
+}
+
+// Collect marks the ucans reachable from the roots and sweeps the store
+func (gc *GarbageCollector) Collect(ctx context.Context) (*GCReport, error) {
+	gc.lk.Lock()
+	defer gc.lk.Unlock()
+
+	now := gc.now()
+	reachable, err := gc.mark(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cids, err := gc.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GCReport{Scanned: len(cids), DryRun: gc.dryRun}
+	garbage := make([]cid.Cid, 0)
+	listed := make(map[cid.Cid]bool, len(cids))
+	for _, c := range cids {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		listed[c] = true
+
+		expired, err := gc.expired(ctx, c, now)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			report.Unreadable = append(report.Unreadable, c)
+			continue
+		}
+		switch {
+		case expired:
+			report.Expired = append(report.Expired, c)
+			garbage = append(garbage, c)
+		case reachable[c]:
+			report.Reachable++
+			delete(gc.unreachable, c)
+		default:
+			since, seen := gc.unreachable[c]
+			if !seen {
+				since = now
+				if !gc.dryRun {
+					gc.unreachable[c] = now
+				}
+			}
+			if now.Sub(since) >= gc.grace {
+				report.Unreachable = append(report.Unreachable, c)
+				garbage = append(garbage, c)
+			}
+		}
+	}
+	// forget ucans deleted by others
+	for c := range gc.unreachable {
+		if !listed[c] {
+			delete(gc.unreachable, c)
+		}
+	}
+	if gc.dryRun {
+		return report, nil
+	}
+
+	for _, c := range garbage {
+		err = gc.store.Delete(c)
+		if err != nil {
+			return report, err
+		}
+		delete(gc.unreachable, c)
+		report.Deleted = append(report.Deleted, c)
+	}
+	return report, nil
+}
+
+// mark walks the prf links of the roots, missing and unreadable ucans are skipped
+func (gc *GarbageCollector) mark(ctx context.Context) (map[cid.Cid]bool, error) {
+	reachable := make(map[cid.Cid]bool)
+	pending := append([]cid.Cid(nil), gc.roots...)
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+		if reachable[c] {
+			continue
+		}
+		reachable[c] = true
+
+		uc, err := gc.read(ctx, c)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			continue
+		}
+		for _, prf := range uc.Proofs() {
+			prfCid, err := cid.Decode(prf)
+			if err != nil {
+				continue
+			}
+			pending = append(pending, prfCid)
+		}
+	}
+	return reachable, nil
+}
+
+// expired reports whether the ucan of c expired longer than the grace period
+// ago, ucans which are gone in the meantime are not expired
+func (gc *GarbageCollector) expired(ctx context.Context, c cid.Cid, now time.Time) (bool, error) {
+	uc, err := gc.read(ctx, c)
+	if errors.Is(err, UcanNotFoundError) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	exp := uc.Expires()
+	return exp != nil && time.Unix(*exp, 0).Add(gc.grace).Before(now), nil
+}
+
+func (gc *GarbageCollector) read(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	if p, ok := gc.store.(peeker); ok {
+		str, err := p.PeekUcanStr(c)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeUcanString(str)
+	}
+	return NewContextStore(gc.store).ReadUcanContext(ctx, c)
+}
+
+// CollectGarbage deletes the ucans of store which are expired or not reachable from roots
+func CollectGarbage(ctx context.Context, store EnumerableUcanStore, roots ...cid.Cid) (*GCReport, error) {
+	return NewGarbageCollector(store).WithRoots(roots...).Collect(ctx)
+}
@@ -0,0 +1,118 @@
+package ucan
+
+import (
+	"context"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCollectsUnreachableUcans(t *testing.T) {
+	store := NewMemoryStore()
+	grant := buildLeaf(t, 60)
+	grantCid, err := store.WriteUcan(grant, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCid, err := store.WriteUcan(leaf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	report, err := NewGarbageCollector(store).WithRoots(leafCid).DryRun().Collect(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Scanned)
+	assert.Equal(t, 2, report.Reachable)
+	assert.Equal(t, []cid.Cid{garbage}, report.Unreachable)
+	assert.Empty(t, report.Deleted)
+	assert.Equal(t, 3, store.Len())
+
+	report, err = CollectGarbage(ctx, store, leafCid)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{garbage}, report.Deleted)
+	assert.False(t, store.Has(garbage))
+	_, err = ProofChainFromUcanCid(leafCid, nil, store)
+	assert.NoError(t, err)
+
+	report, err = CollectGarbage(ctx, store)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []cid.Cid{leafCid, grantCid}, report.Deleted)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestGracePeriod(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	expiring, err := store.WriteUcan(buildLeaf(t, 10), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable, err := store.WriteUcan(buildLeaf(t, 7200), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gc := NewGarbageCollector(store).WithRoots(expiring).WithGracePeriod(time.Hour)
+	gc.now = func() time.Time {
+		return now.Add(time.Minute)
+	}
+	report, err := gc.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, report.Deleted)
+
+	// the root expired and the other ucan is unreachable for longer than the grace period
+	gc.now = func() time.Time {
+		return now.Add(2 * time.Hour)
+	}
+	report, err = gc.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{expiring}, report.Expired)
+	assert.Equal(t, []cid.Cid{unreachable}, report.Unreachable)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestSkipsUnreadableUcans(t *testing.T) {
+	store := NewMemoryStore()
+	kept, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt, err := DefaultPrefix.Sum([]byte("not a ucan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.put(corrupt, "not a ucan", nil)
+	other, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := store.List()
+	assert.NoError(t, err)
+
+	report, err := NewGarbageCollector(store).WithRoots(kept, corrupt).DryRun().Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{corrupt}, report.Unreadable)
+	assert.Equal(t, []cid.Cid{other}, report.Unreachable)
+	assert.Equal(t, 1, report.Reachable)
+
+	// collections do not refresh the recency of the ucans
+	after, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+}
@@ -0,0 +1,55 @@
+package grpcauth
+
+import (
+	"context"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"google.golang.org/grpc/credentials"
+	"strings"
+)
+
+var _ credentials.PerRPCCredentials = &Credentials{}
+
+// Credentials attach a ucan and its proofs to every call of a client, e.g.
+//
+//	grpc.Dial(target, grpc.WithPerRPCCredentials(creds))
+type Credentials struct {
+	token    string
+	proofs   []string
+	insecure bool
+}
+
+// NewCredentials encodes the ucan sent with every call and the proofs it needs
+func NewCredentials(uc *ucan.Ucan, proofs ...*ucan.Ucan) (*Credentials, error) {
+	token, err := uc.Encode()
+	if err != nil {
+		return nil, err
+	}
+	encodedProofs := make([]string, 0, len(proofs))
+	for _, prf := range proofs {
+		encoded, err := prf.Encode()
+		if err != nil {
+			return nil, err
+		}
+		encodedProofs = append(encodedProofs, encoded)
+	}
+	return &Credentials{token: token, proofs: encodedProofs}, nil
+}
+
+// WithInsecureTransport allows sending the ucan over connections without
+// transport security, ucans are bearer tokens until they expire.
+func (c *Credentials) WithInsecureTransport() *Credentials {
+	c.insecure = true
+	return c
+}
+
+func (c *Credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := map[string]string{AuthorizationKey: "Bearer " + c.token}
+	if len(c.proofs) > 0 {
+		md[UcansKey] = strings.Join(c.proofs, ",")
+	}
+	return md, nil
+}
+
+func (c *Credentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
@@ -0,0 +1,207 @@
+// Package grpcauth authorizes gRPC calls with ucans. Calls carry the ucan as a
+// bearer token in the authorization metadata and its proofs in the ucans
+// metadata, a call of /pkg.Service/Method needs a capability on
+// grpc://pkg.Service/Method.
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"strings"
+)
+
+const (
+	AuthorizationKey = "authorization"
+	UcansKey         = "ucans"
+	// DefaultAbility is required by methods without a declared ability
+	DefaultAbility = "grpc/invoke"
+)
+
+var MissingTokenError = fmt.Errorf("missing bearer token")
+
+// Semantics understands grpc:// resources with any namespaced ability
+var Semantics = capability.CapabilitySemantics[MethodScope, Ability]{}
+
+var _ capability.Scope = &MethodScope{}
+
+// MethodScope is a grpc://service/Method resource, grpc://service contains
+// every method of the service. Names are case sensitive like in gRPC.
+type MethodScope struct {
+	service string
+	method  string
+}
+
+func (s MethodScope) Contains(other capability.Scope) bool {
+	otherScope, ok := other.(*MethodScope)
+	if !ok || s.service != otherScope.service {
+		return false
+	}
+	return s.method == "" || s.method == otherScope.method
+}
+
+func (s MethodScope) ParseScope(url url.URL) (capability.Scope, error) {
+	if url.Scheme != "grpc" || url.Host == "" || url.User != nil || url.RawQuery != "" || url.Fragment != "" {
+		return nil, fmt.Errorf("cannot interpret URI as grpc resource: %s", url.String())
+	}
+	method := strings.TrimPrefix(url.Path, "/")
+	if strings.Contains(method, "/") {
+		return nil, fmt.Errorf("invalid grpc method: %s", method)
+	}
+	return &MethodScope{service: url.Host, method: method}, nil
+}
+
+func (s MethodScope) ToString() string {
+	if s.method == "" {
+		return "grpc://" + s.service
+	}
+	return "grpc://" + s.service + "/" + s.method
+}
+
+// Ability is any namespaced ability, methods declare which one they need
+type Ability = capability.NamespacedAbility[capability.NoImplications]
+
+// MethodCapability returns the capability needed to call fullMethod, as in
+// grpc.UnaryServerInfo, with ability
+func MethodCapability(fullMethod string, ability string) (*capability.Capability, error) {
+	return capability.BuildCapability("grpc://"+strings.TrimPrefix(fullMethod, "/"), ability, capability.NullJson)
+}
+
+type contextKey struct{}
+
+// FromContext returns the capability verified by the interceptors
+func FromContext(ctx context.Context) (*ucan.CapabilityInfo, bool) {
+	capInfo, ok := ctx.Value(contextKey{}).(*ucan.CapabilityInfo)
+	return capInfo, ok
+}
+
+// Interceptor authorizes unary and streaming calls, invalid tokens fail with
+// codes.Unauthenticated and missing capabilities with codes.PermissionDenied.
+type Interceptor struct {
+	authorizer     *ucan.Authorizer
+	defaultAbility string
+	abilities      map[string]string
+	public         map[string]bool
+}
+
+func NewInterceptor(authorizer *ucan.Authorizer) *Interceptor {
+	return &Interceptor{
+		authorizer:     authorizer,
+		defaultAbility: DefaultAbility,
+		abilities:      make(map[string]string),
+		public:         make(map[string]bool),
+	}
+}
+
+// WithDefaultAbility sets the ability required by methods without a declared ability
+func (i *Interceptor) WithDefaultAbility(ability string) *Interceptor {
+	i.defaultAbility = ability
+	return i
+}
+
+// WithAbility declares the ability required to call fullMethod, e.g.
+// /photos.Photos/Delete requiring photos/delete
+func (i *Interceptor) WithAbility(fullMethod string, ability string) *Interceptor {
+	i.abilities[fullMethod] = ability
+	return i
+}
+
+// WithPublicMethods lets anyone call the methods, e.g. health checks
+func (i *Interceptor) WithPublicMethods(fullMethods ...string) *Interceptor {
+	for _, method := range fullMethods {
+		i.public[method] = true
+	}
+	return i
+}
+
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (i *Interceptor) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if i.public[fullMethod] {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, err := bearerToken(md)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	ability, ok := i.abilities[fullMethod]
+	if !ok {
+		ability = i.defaultAbility
+	}
+	required, err := MethodCapability(fullMethod, ability)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	capInfo, err := i.authorizer.Authorize(ctx, token, proofs(md), required)
+	if err != nil {
+		if errors.Is(err, ucan.NotAuthorizedError) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, contextKey{}, capInfo), nil
+}
+
+// authorizedStream carries the verified capability in the context of a stream
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func bearerToken(md metadata.MD) (string, error) {
+	values := md.Get(AuthorizationKey)
+	if len(values) == 0 {
+		return "", MissingTokenError
+	}
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", MissingTokenError
+	}
+	return strings.TrimSpace(token), nil
+}
+
+func proofs(md metadata.MD) []string {
+	proofs := make([]string, 0)
+	for _, value := range md.Get(UcansKey) {
+		for _, prf := range strings.Split(value, ",") {
+			if prf = strings.TrimSpace(prf); prf != "" {
+				proofs = append(proofs, prf)
+			}
+		}
+	}
+	return proofs
+}
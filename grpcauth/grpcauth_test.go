@@ -0,0 +1,175 @@
+package grpcauth
+
+import (
+	"context"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+const (
+	checkMethod = "/grpc.health.v1.Health/Check"
+	watchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+// startHealthServer serves the health service of the service alice on an in
+// process connection, the capability of every authorized call is recorded
+func startHealthServer(t *testing.T, interceptor *Interceptor, verified chan<- *ucan.CapabilityInfo) *bufconn.Listener {
+	record := func(ctx context.Context) {
+		if capInfo, ok := FromContext(ctx); ok {
+			verified <- capInfo
+		}
+	}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptor.Unary(),
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				record(ctx)
+				return handler(ctx, req)
+			}),
+		grpc.ChainStreamInterceptor(interceptor.Stream(),
+			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				record(ss.Context())
+				return handler(srv, ss)
+			}),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return listener
+}
+
+func dial(t *testing.T, listener *bufconn.Listener, opts ...grpc.DialOption) healthpb.HealthClient {
+	opts = append(opts,
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial("bufnet", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return healthpb.NewHealthClient(conn)
+}
+
+// bobCredentials lets bob call the health service with the given ability granted by alice
+func bobCredentials(t *testing.T, resource string, ability string) *Credentials {
+	grant, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(capability.NewCapability(resource, ability, capability.NullJson)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.AliceDidString).
+		WithLifetime(50).
+		DelegatingFrom(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := NewCredentials(invocation, grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creds.WithInsecureTransport()
+}
+
+func newInterceptor() *Interceptor {
+	return NewInterceptor(ucan.NewAuthorizer(fixtures.TestIdentities.AliceDidString, Semantics)).
+		WithAbility(watchMethod, "health/watch")
+}
+
+func TestAuthorizesUnaryCalls(t *testing.T) {
+	verified := make(chan *ucan.CapabilityInfo, 1)
+	listener := startHealthServer(t, newInterceptor(), verified)
+	ctx := context.Background()
+
+	client := dial(t, listener, grpc.WithPerRPCCredentials(bobCredentials(t, "grpc://grpc.health.v1.Health", DefaultAbility)))
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	capInfo := <-verified
+	assert.Equal(t, "grpc://grpc.health.v1.Health", capInfo.Capability.Resource.ToString())
+
+	client = dial(t, listener, grpc.WithPerRPCCredentials(bobCredentials(t, "grpc://grpc.health.v1.Health/Watch", DefaultAbility)))
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	client = dial(t, listener)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthorizesStreamsWithDeclaredAbilities(t *testing.T) {
+	verified := make(chan *ucan.CapabilityInfo, 1)
+	listener := startHealthServer(t, newInterceptor(), verified)
+	ctx := context.Background()
+
+	client := dial(t, listener, grpc.WithPerRPCCredentials(bobCredentials(t, "grpc://grpc.health.v1.Health/Watch", "health/watch")))
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	capInfo := <-verified
+	assert.Equal(t, "health/watch", capInfo.Capability.Ability.ToString())
+
+	client = dial(t, listener, grpc.WithPerRPCCredentials(bobCredentials(t, "grpc://grpc.health.v1.Health", DefaultAbility)))
+	stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestPublicMethods(t *testing.T) {
+	listener := startHealthServer(t, newInterceptor().WithPublicMethods(checkMethod), make(chan *ucan.CapabilityInfo, 1))
+	_, err := dial(t, listener).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+}
+
+func TestMethodScopes(t *testing.T) {
+	parse := func(fullMethod string) *capability.CapabilityView {
+		required, err := MethodCapability(fullMethod, "photos/delete")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cv, err := Semantics.ParseCapability(required)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cv
+	}
+	service, method, otherService := parse("/photos.Photos"), parse("/photos.Photos/Delete"), parse("/photos.photos/Delete")
+
+	assert.True(t, service.Enables(method))
+	assert.False(t, method.Enables(service))
+	assert.False(t, service.Enables(otherService))
+
+	_, err := Semantics.ParseCapability(capability.NewCapability("grpc://photos.Photos/Delete/x", "photos/delete", capability.NullJson))
+	assert.Error(t, err)
+}
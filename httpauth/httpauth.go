@@ -0,0 +1,136 @@
+// Package httpauth protects net/http handlers with ucans. Requests carry the
+// ucan as a bearer token and its proofs, comma separated, in the ucans header.
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// UcansHeader carries the encoded proofs of the bearer token
+const UcansHeader = "ucans"
+
+var (
+	MissingTokenError     = fmt.Errorf("missing bearer token")
+	NonCanonicalPathError = fmt.Errorf("non canonical request path")
+)
+
+type contextKey struct{}
+
+// Middleware authorizes every request against the capability mapped from its
+// method and url, e.g. GET https://api.example.com/photos needs http/get on
+// https://api.example.com/photos.
+type Middleware struct {
+	authorizer *ucan.Authorizer
+	origin     url.URL
+}
+
+// NewMiddleware authorizes requests for resources under the scheme and host of
+// the service. The Host header is set by clients and is never trusted.
+func NewMiddleware(authorizer *ucan.Authorizer, scheme string, host string) *Middleware {
+	return &Middleware{authorizer: authorizer, origin: url.URL{Scheme: scheme, Host: host}}
+}
+
+// Handler calls next with the verified capability in the request context,
+// non canonical paths are answered with 400, invalid tokens with 401 and
+// missing capabilities with 403.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capInfo, err := m.authorize(r)
+		if err != nil {
+			if errors.Is(err, NonCanonicalPathError) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, ucan.NotAuthorizedError) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, capInfo)))
+	})
+}
+
+func (m *Middleware) authorize(r *http.Request) (*ucan.CapabilityInfo, error) {
+	err := CheckCanonicalPath(r)
+	if err != nil {
+		return nil, err
+	}
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	required, err := m.RequestCapability(r)
+	if err != nil {
+		return nil, err
+	}
+	return m.authorizer.Authorize(r.Context(), token, Proofs(r), required)
+}
+
+// RequestCapability maps a request to the capability needed to serve it
+func (m *Middleware) RequestCapability(r *http.Request) (*capability.Capability, error) {
+	resource := url.URL{
+		Scheme:   m.origin.Scheme,
+		Host:     m.origin.Host,
+		Path:     r.URL.Path,
+		RawPath:  r.URL.RawPath,
+		RawQuery: r.URL.RawQuery,
+	}
+	return capability.BuildCapability(resource.String(), capability.HTTPMethodAbility(r.Method), capability.NullJson)
+}
+
+// CheckCanonicalPath rejects paths which handlers and muxes may resolve to
+// another resource than the one authorized, like /public/../admin or escaped
+// dot segments and slashes
+func CheckCanonicalPath(r *http.Request) error {
+	p := r.URL.Path
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if p != cleaned {
+		return fmt.Errorf("%w: %s", NonCanonicalPathError, r.URL.EscapedPath())
+	}
+	if _, err := capability.NormalizePath(r.URL.EscapedPath()); err != nil {
+		return fmt.Errorf("%w: %v", NonCanonicalPathError, err)
+	}
+	return nil
+}
+
+// BearerToken returns the ucan of the authorization header
+func BearerToken(r *http.Request) (string, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", MissingTokenError
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// Proofs returns the encoded proofs of the ucans headers
+func Proofs(r *http.Request) []string {
+	proofs := make([]string, 0)
+	for _, header := range r.Header.Values(UcansHeader) {
+		for _, prf := range strings.Split(header, ",") {
+			if prf = strings.TrimSpace(prf); prf != "" {
+				proofs = append(proofs, prf)
+			}
+		}
+	}
+	return proofs
+}
+
+// FromContext returns the capability verified by the middleware
+func FromContext(ctx context.Context) (*ucan.CapabilityInfo, bool) {
+	capInfo, ok := ctx.Value(contextKey{}).(*ucan.CapabilityInfo)
+	return capInfo, ok
+}
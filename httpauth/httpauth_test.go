@@ -0,0 +1,143 @@
+package httpauth
+
+import (
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func photosToken(t *testing.T) (string, string) {
+	return grantToken(t, "https://api.example.com/photos")
+}
+
+// grantToken returns an invocation of bob and the grant of alice for http/* on resource
+func grantToken(t *testing.T, resource string) (string, string) {
+	grant, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		ClaimingCapability(capability.NewCapability(resource, "http/*", capability.NullJson)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	invocation, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.AliceDidString).
+		WithLifetime(50).
+		DelegatingFrom(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grantStr, err := grant.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := invocation.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, grantStr
+}
+
+func TestMiddleware(t *testing.T) {
+	token, grant := photosToken(t)
+	authorizer := ucan.NewAuthorizer(fixtures.TestIdentities.AliceDidString, capability.HTTPSemantics)
+	handler := NewMiddleware(authorizer, "https", "api.example.com").Handler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			capInfo, ok := FromContext(r.Context())
+			assert.True(t, ok)
+			_, _ = w.Write([]byte(capInfo.Capability.Resource.ToString()))
+		}))
+
+	serve := func(method string, target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for key, values := range header {
+			for _, val := range values {
+				r.Header.Add(key, val)
+			}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	authorized := http.Header{
+		"Authorization": {"Bearer " + token},
+		UcansHeader:     {grant},
+	}
+
+	w := serve(http.MethodPost, "http://localhost/photos/1", authorized)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://api.example.com/photos", w.Body.String())
+
+	w = serve(http.MethodGet, "http://localhost/users", authorized)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(http.MethodGet, "http://localhost/photos/../users", authorized)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(http.MethodGet, "http://localhost/photos", http.Header{"Authorization": {"Bearer " + token}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serve(http.MethodGet, "http://localhost/photos", http.Header{UcansHeader: {grant}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+}
+
+func TestRequestCapability(t *testing.T) {
+	m := NewMiddleware(nil, "https", "api.example.com")
+	r := httptest.NewRequest(http.MethodDelete, "http://api.example.com/photos/a%2Fb?force=true", nil)
+	r.Host = "evil.example.com"
+	required, err := m.RequestCapability(r)
+	assert.NoError(t, err)
+	assert.Equal(t, &capability.Capability{
+		Resource: "https://api.example.com/photos/a%2Fb?force=true",
+		Ability:  "http/delete",
+		Caveat:   "{}",
+	}, required)
+}
+
+func TestProofsOfSeveralHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+	r.Header.Add(UcansHeader, "a, b")
+	r.Header.Add(UcansHeader, "c,")
+	assert.Equal(t, []string{"a", "b", "c"}, Proofs(r))
+
+	r.Header.Set("Authorization", "bearer  "+strings.Repeat("x", 3))
+	token, err := BearerToken(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "xxx", token)
+}
+
+func TestDeniesEncodedTraversal(t *testing.T) {
+	token, grant := grantToken(t, "https://api.example.com/public")
+	authorizer := ucan.NewAuthorizer(fixtures.TestIdentities.AliceDidString, capability.HTTPSemantics)
+	reached := false
+	handler := NewMiddleware(authorizer, "https", "api.example.com").Handler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+
+	for target, code := range map[string]int{
+		"http://api.example.com/public/photos":       http.StatusOK,
+		"http://api.example.com/public/%2e%2e/admin": http.StatusBadRequest,
+		"http://api.example.com/public/%2E%2E/admin": http.StatusBadRequest,
+		"http://api.example.com/public%2F..%2Fadmin": http.StatusBadRequest,
+		"http://api.example.com/public/./admin":      http.StatusBadRequest,
+	} {
+		reached = false
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set(UcansHeader, grant)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, code, w.Code, target)
+		assert.Equal(t, code == http.StatusOK, reached, target)
+	}
+}
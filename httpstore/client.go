@@ -0,0 +1,242 @@
+package httpstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/car"
+	"github.com/ipfs/go-cid"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultCacheSize bounds the default cache of a client
+const DefaultCacheSize = 1024
+
+var _ ucan.UcanStore = &Client{}
+var _ ucan.ContextUcanStore = &Client{}
+
+// Client resolves ucans from a Server. Responses are checked against their
+// cids and cached, writes fail with ucan.ReadOnlyStoreError so a client can be
+// the last tier of a ucan.TieredStore.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	cache      ucan.UcanStore
+}
+
+// NewClient resolves ucans from the server at baseURL, e.g. https://issuer.example.com
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		cache:      ucan.NewMemoryStore().WithMaxEntries(DefaultCacheSize),
+	}
+}
+
+func (cl *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	cl.httpClient = httpClient
+	return cl
+}
+
+// WithCache keeps resolved ucans in cache instead of a bounded MemoryStore
+func (cl *Client) WithCache(cache ucan.UcanStore) *Client {
+	cl.cache = cache
+	return cl
+}
+
+func (cl *Client) ReadUcan(c cid.Cid) (*ucan.Ucan, error) {
+	return cl.ReadUcanContext(context.Background(), c)
+}
+
+func (cl *Client) WriteUcan(*ucan.Ucan, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ucan.ReadOnlyStoreError
+}
+
+func (cl *Client) ReadUcanStr(c cid.Cid) (string, error) {
+	return cl.ReadUcanStrContext(context.Background(), c)
+}
+
+func (cl *Client) WriteUcanStr(string, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ucan.ReadOnlyStoreError
+}
+
+func (cl *Client) ReadUcanContext(ctx context.Context, c cid.Cid) (*ucan.Ucan, error) {
+	str, err := cl.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return ucan.DecodeUcanString(str)
+}
+
+func (cl *Client) WriteUcanContext(context.Context, *ucan.Ucan, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ucan.ReadOnlyStoreError
+}
+
+func (cl *Client) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	if str, err := ucan.NewContextStore(cl.cache).ReadUcanStrContext(ctx, c); err == nil && ucan.VerifyUcanCid(c, str) == nil {
+		return str, nil
+	}
+
+	body, err := cl.do(ctx, http.MethodGet, PathPrefix+"/"+c.String(), UcanContentType, nil)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", c.String(), err)
+	}
+	str := string(body)
+	err = cl.remember(ctx, c, str)
+	if err != nil {
+		return "", err
+	}
+	return str, nil
+}
+
+func (cl *Client) WriteUcanStrContext(context.Context, string, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ucan.ReadOnlyStoreError
+}
+
+// Fetch resolves several ucans with one request and returns them together with
+// the cids the server reported as missing. A response accounting for neither
+// a ucan nor a missing cid fails with IncompleteBatchError.
+func (cl *Client) Fetch(ctx context.Context, cids ...cid.Cid) (map[cid.Cid]string, []cid.Cid, error) {
+	req := batchRequest{Cids: make([]string, len(cids))}
+	for i, c := range cids {
+		req.Cids[i] = c.String()
+	}
+	reqBody, err := json.Marshal(&req)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := cl.do(ctx, http.MethodPost, PathPrefix, "application/json", reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := batchResponse{}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reported := make(map[string]bool, len(resp.Missing))
+	for _, cidStr := range resp.Missing {
+		reported[cidStr] = true
+	}
+	ucans := make(map[cid.Cid]string, len(resp.Ucans))
+	missing := make([]cid.Cid, 0)
+	for _, c := range cids {
+		str, ok := resp.Ucans[c.String()]
+		if !ok {
+			if !reported[c.String()] {
+				return nil, nil, fmt.Errorf("%w: %s", IncompleteBatchError, c.String())
+			}
+			missing = append(missing, c)
+			continue
+		}
+		err = cl.remember(ctx, c, str)
+		if err != nil {
+			return nil, nil, err
+		}
+		ucans[c] = str
+	}
+	return ucans, missing, nil
+}
+
+// FetchChain resolves the ucan of c and all its proofs with one CAR request
+// and caches them, so a proof chain can be built without further requests.
+// Only the ucans reachable from c are cached, other blocks of the CAR are dropped.
+func (cl *Client) FetchChain(ctx context.Context, c cid.Cid) error {
+	body, err := cl.do(ctx, http.MethodGet, PathPrefix+"/"+c.String(), CarContentType, nil)
+	if err != nil {
+		return fmt.Errorf("resolving chain of %s: %w", c.String(), err)
+	}
+	blocks := ucan.NewMemoryStore()
+	_, err = car.Import(ctx, bytes.NewReader(body), blocks)
+	if err != nil {
+		return err
+	}
+
+	pending := []cid.Cid{c}
+	seen := make(map[cid.Cid]bool)
+	for len(pending) > 0 {
+		next := pending[0]
+		pending = pending[1:]
+		if seen[next] {
+			continue
+		}
+		seen[next] = true
+
+		str, err := blocks.ReadUcanStr(next)
+		if err != nil {
+			if next.Equals(c) {
+				return fmt.Errorf("resolving chain of %s: %w", c.String(), err)
+			}
+			// proofs left out of the CAR are resolved on demand
+			continue
+		}
+		err = cl.remember(ctx, next, str)
+		if err != nil {
+			return err
+		}
+		uc, err := ucan.DecodeUcanString(str)
+		if err != nil {
+			return err
+		}
+		for _, prf := range uc.Proofs() {
+			prfCid, err := cid.Decode(prf)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, prfCid)
+		}
+	}
+	return nil
+}
+
+// remember caches str after checking it against c
+func (cl *Client) remember(ctx context.Context, c cid.Cid, str string) error {
+	err := ucan.VerifyUcanCid(c, str)
+	if err != nil {
+		return err
+	}
+	prefix := c.Prefix()
+	_, err = ucan.NewContextStore(cl.cache).WriteUcanStrContext(ctx, str, &prefix)
+	return err
+}
+
+func (cl *Client) do(ctx context.Context, method string, path string, accept string, reqBody []byte) ([]byte, error) {
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cl.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := cl.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(respBody) > MaxResponseSize {
+		return nil, fmt.Errorf("response exceeds %d bytes", MaxResponseSize)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return respBody, nil
+	case http.StatusNotFound:
+		return nil, ucan.UcanNotFoundError
+	default:
+		return nil, fmt.Errorf("%w %s: %s", UnexpectedStatusError, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+}
@@ -0,0 +1,151 @@
+package httpstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/car"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolvesMissingProofsFromTheIssuer(t *testing.T) {
+	issuerStore := ucan.NewMemoryStore()
+	leafCid, grantCid := delegation(t, issuerStore)
+	srv := httptest.NewServer(NewServer(issuerStore))
+	defer srv.Close()
+
+	local := ucan.NewMemoryStore()
+	leaf, err := issuerStore.ReadUcan(leafCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(srv.URL + "/")
+	_, err = ucan.ProofChainFromUcan(leaf, nil, ucan.NewTieredStore(local, client))
+	assert.NoError(t, err)
+	assert.True(t, local.Has(grantCid))
+
+	missingCid, _ := delegation(t, ucan.NewMemoryStore())
+	ucans, missing, err := client.Fetch(context.Background(), leafCid, missingCid)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(ucans))
+	assert.Equal(t, []cid.Cid{missingCid}, missing)
+
+	_, err = client.WriteUcan(leaf, nil)
+	assert.ErrorIs(t, err, ucan.ReadOnlyStoreError)
+}
+
+func TestFetchesWholeChains(t *testing.T) {
+	issuerStore := ucan.NewMemoryStore()
+	leafCid, _ := delegation(t, issuerStore)
+	srv := httptest.NewServer(NewServer(issuerStore))
+
+	cache := ucan.NewMemoryStore()
+	client := NewClient(srv.URL).WithCache(cache)
+	assert.NoError(t, client.FetchChain(context.Background(), leafCid))
+	srv.Close()
+
+	assert.Equal(t, 2, cache.Len())
+	_, err := ucan.ProofChainFromUcanCid(leafCid, nil, client)
+	assert.NoError(t, err)
+
+	_, err = NewClient(srv.URL).ReadUcan(leafCid)
+	assert.Error(t, err)
+}
+
+func TestFetchesPartialChains(t *testing.T) {
+	issuerStore := ucan.NewMemoryStore()
+	leafCid, grantCid := delegation(t, issuerStore)
+	grantStr, err := issuerStore.ReadUcanStr(grantCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverStore := ucan.NewMemoryStore()
+	leafStr, err := issuerStore.ReadUcanStr(leafCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPrefix := leafCid.Prefix()
+	_, err = serverStore.WriteUcanStr(leafStr, &leafPrefix)
+	assert.NoError(t, err)
+	srv := httptest.NewServer(NewServer(serverStore))
+	defer srv.Close()
+
+	cache := ucan.NewMemoryStore()
+	client := NewClient(srv.URL).WithCache(cache)
+	assert.NoError(t, client.FetchChain(context.Background(), leafCid))
+	assert.Equal(t, 1, cache.Len())
+	assert.False(t, cache.Has(grantCid))
+
+	// the proof left out of the CAR is resolved once the server has it
+	grantPrefix := grantCid.Prefix()
+	_, err = serverStore.WriteUcanStr(grantStr, &grantPrefix)
+	assert.NoError(t, err)
+	_, err = ucan.ProofChainFromUcanCid(leafCid, nil, client)
+	assert.NoError(t, err)
+	assert.True(t, cache.Has(grantCid))
+}
+
+func TestRejectsTamperedResponses(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	leafCid, grantCid := delegation(t, store)
+	grantStr, err := store.ReadUcanStr(grantCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, grantStr)
+	}))
+	defer srv.Close()
+
+	_, err = NewClient(srv.URL).ReadUcanStr(leafCid)
+	assert.ErrorIs(t, err, ucan.UcanCidMismatchError)
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	_, err = NewClient(missing.URL).WithHTTPClient(missing.Client()).ReadUcanStr(leafCid)
+	assert.ErrorIs(t, err, ucan.UcanNotFoundError)
+	_, err = ucan.ProofChainFromUcanCid(leafCid, nil, NewClient(missing.URL).WithCache(ucan.NewMemoryStore()))
+	assert.ErrorIs(t, err, ucan.UcanNotFoundError)
+}
+
+func TestCachesOnlyTheRequestedChain(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	leafCid, _ := delegation(t, store)
+	otherCid, otherGrantCid := delegation(t, store)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		cw, err := car.NewWriter(&buf, leafCid)
+		assert.NoError(t, err)
+		assert.NoError(t, cw.PutFromStore(r.Context(), store, true, leafCid, otherCid))
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	cache := ucan.NewMemoryStore()
+	assert.NoError(t, NewClient(srv.URL).WithCache(cache).FetchChain(context.Background(), leafCid))
+	assert.Equal(t, 2, cache.Len())
+	assert.False(t, cache.Has(otherCid))
+	assert.False(t, cache.Has(otherGrantCid))
+}
+
+func TestRejectsIncompleteBatches(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	leafCid, grantCid := delegation(t, store)
+	grantStr, err := store.ReadUcanStr(grantCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&batchResponse{Ucans: map[string]string{grantCid.String(): grantStr}})
+	}))
+	defer srv.Close()
+
+	_, _, err = NewClient(srv.URL).Fetch(context.Background(), grantCid, leafCid)
+	assert.ErrorIs(t, err, IncompleteBatchError)
+}
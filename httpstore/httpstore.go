@@ -0,0 +1,170 @@
+// Package httpstore serves ucans by cid over HTTP and resolves them with a
+// client implementing UcanStore, so services can fetch missing proofs from the
+// endpoint of an issuer.
+//
+//	GET  /ucan/<cid>  the encoded ucan, or with Accept: application/vnd.ipld.car
+//	                  a CAR of the ucan and all its proofs
+//	POST /ucan        a batchRequest, answered with a batchResponse
+package httpstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/car"
+	"github.com/ipfs/go-cid"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	PathPrefix = "/ucan"
+	// UcanContentType is the media type of a single encoded ucan
+	UcanContentType = "application/jwt"
+	// CarContentType is the media type of CAR responses
+	CarContentType = "application/vnd.ipld.car"
+	// MaxBatchSize bounds the number of cids of a batch request
+	MaxBatchSize = 64
+	// MaxRequestSize bounds the size of batch requests read by the server
+	MaxRequestSize = 64 << 10
+	// MaxResponseSize bounds the size of responses read by the client
+	MaxResponseSize = 8 << 20
+)
+
+var (
+	UnexpectedStatusError = fmt.Errorf("unexpected response status")
+	IncompleteBatchError  = fmt.Errorf("batch response neither holds nor misses a cid")
+)
+
+// batchRequest asks for the ucans of several cids
+type batchRequest struct {
+	Cids []string `json:"cids"`
+}
+
+// batchResponse holds the found ucans by cid and the missing cids
+type batchResponse struct {
+	Ucans   map[string]string `json:"ucans"`
+	Missing []string          `json:"missing,omitempty"`
+}
+
+// Server serves the ucans of a store, it never writes to the store
+type Server struct {
+	ucans        ucan.UcanStore
+	store        ucan.ContextUcanStore
+	maxBatchSize int
+}
+
+func NewServer(store ucan.UcanStore) *Server {
+	return &Server{
+		ucans:        store,
+		store:        ucan.NewContextStore(store),
+		maxBatchSize: MaxBatchSize,
+	}
+}
+
+// WithMaxBatchSize bounds the number of cids of a batch request
+func (s *Server) WithMaxBatchSize(n int) *Server {
+	s.maxBatchSize = n
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == PathPrefix && r.Method == http.MethodPost:
+		s.serveBatch(w, r)
+	case strings.HasPrefix(r.URL.Path, PathPrefix+"/") && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		s.serveUcan(w, r, strings.TrimPrefix(r.URL.Path, PathPrefix+"/"))
+	case r.URL.Path == PathPrefix || strings.HasPrefix(r.URL.Path, PathPrefix+"/"):
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveUcan(w http.ResponseWriter, r *http.Request, cidStr string) {
+	c, err := cid.Decode(cidStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ucanStr, err := s.store.ReadUcanStrContext(r.Context(), c)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	// content addressed responses never change
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+c.String()+`"`)
+	if !strings.Contains(r.Header.Get("Accept"), CarContentType) {
+		w.Header().Set("Content-Type", UcanContentType)
+		_, _ = io.WriteString(w, ucanStr)
+		return
+	}
+
+	// build the CAR before writing, so errors still fail with a status. Proofs
+	// missing in the store are left out, clients resolve them on demand
+	var buf bytes.Buffer
+	cw, err := car.NewWriter(&buf, c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = cw.WithPartialChains().PutFromStore(r.Context(), s.ucans, true, c)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", CarContentType)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	req := batchRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestSize)).Decode(&req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Cids) > s.maxBatchSize {
+		http.Error(w, fmt.Sprintf("batch of %d cids exceeds %d cids", len(req.Cids), s.maxBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp := batchResponse{Ucans: make(map[string]string, len(req.Cids))}
+	for _, cidStr := range req.Cids {
+		c, err := cid.Decode(cidStr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ucanStr, err := s.store.ReadUcanStrContext(r.Context(), c)
+		if errors.Is(err, ucan.UcanNotFoundError) {
+			resp.Missing = append(resp.Missing, cidStr)
+			continue
+		}
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		resp.Ucans[cidStr] = ucanStr
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&resp)
+}
+
+func storeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ucan.UcanNotFoundError) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,102 @@
+package httpstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/car"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// delegation stores a grant of alice to bob and the delegation of bob to
+// mallory, the cids of both are returned
+func delegation(t *testing.T, store ucan.UcanStore) (cid.Cid, cid.Cid) {
+	grant, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		WithNonce().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grantCid, err := store.WriteUcan(grant, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCid, err := store.WriteUcan(leaf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leafCid, grantCid
+}
+
+func TestServesUcansByCid(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	leafCid, grantCid := delegation(t, store)
+	server := NewServer(store).WithMaxBatchSize(2)
+
+	serve := func(method string, target string, accept string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/ucan/"+grantCid.String(), "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, UcanContentType, w.Header().Get("Content-Type"))
+	assert.NoError(t, ucan.VerifyUcanCid(grantCid, w.Body.String()))
+
+	w = serve(http.MethodGet, "/ucan/"+leafCid.String(), CarContentType, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, CarContentType, w.Header().Get("Content-Type"))
+	imported := ucan.NewMemoryStore()
+	roots, err := car.Import(context.Background(), w.Body, imported)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{leafCid}, roots)
+	assert.Equal(t, 2, imported.Len())
+
+	missing := ucan.NewMemoryStore()
+	missingCid, _ := delegation(t, missing)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/ucan/"+missingCid.String(), "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/ucan/not-a-cid", "", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "/ucan/"+leafCid.String(), "", "").Code)
+
+	w = serve(http.MethodPost, "/ucan", "", `{"cids": ["`+leafCid.String()+`", "`+missingCid.String()+`"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := batchResponse{}
+	assert.NoError(t, json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&resp))
+	assert.Equal(t, []string{leafCid.String()}, keys(resp.Ucans))
+	assert.Equal(t, []string{missingCid.String()}, resp.Missing)
+
+	w = serve(http.MethodPost, "/ucan", "", `{"cids": ["a", "b", "c"]}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = serve(http.MethodPost, "/ucan", "", `{"cids": ["`+strings.Repeat("a", MaxRequestSize)+`"]}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func keys(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
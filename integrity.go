@@ -0,0 +1,152 @@
+package ucan
+
+import (
+	"context"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+var (
+	UcanCidMismatchError   = fmt.Errorf("ucan does not match its cid")
+	UnsupportedPrefixError = fmt.Errorf("unsupported ucan cid prefix")
+)
+
+// VerifyUcanCid re-hashes ucanStr with the multihash of c, so cids of any
+// supported prefix, like BLAKE3 or SHA2-256, are checked against their own hash
+func VerifyUcanCid(c cid.Cid, ucanStr string) error {
+	prefix := c.Prefix()
+	err := CheckPrefix(&prefix)
+	if err != nil {
+		return err
+	}
+	sum, err := prefix.Sum([]byte(ucanStr))
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("%w: %s", UcanCidMismatchError, c.String())
+	}
+	return nil
+}
+
+// MinDigestLength is the shortest digest, in bytes, accepted for ucan cids
+const MinDigestLength = 32
+
+// CheckPrefix accepts raw codec CIDv1 prefixes of a cryptographic multihash,
+// SHA2, SHA3, BLAKE2b, BLAKE2s or BLAKE3, with a digest of at least
+// MinDigestLength. Other hashes do not protect the integrity of a ucan.
+//
+// This is a breaking change: any prefix used to be accepted, tokens stored or
+// referenced as proofs under other prefixes, like murmur3, now fail to write
+// and to resolve, they have to be written and delegated again with a
+// supported prefix.
+func CheckPrefix(prefix *cid.Prefix) error {
+	if prefix.Version != 1 || prefix.Codec != cid.Raw {
+		return fmt.Errorf("%w: cid v%d with codec 0x%x", UnsupportedPrefixError, prefix.Version, prefix.Codec)
+	}
+	if !cryptographicMultihash(prefix.MhType) {
+		return fmt.Errorf("%w: multihash 0x%x is not cryptographic", UnsupportedPrefixError, prefix.MhType)
+	}
+	hasher, err := mh.GetHasher(prefix.MhType)
+	if err != nil {
+		return fmt.Errorf("%w: %v", UnsupportedPrefixError, err)
+	}
+	length := prefix.MhLength
+	if length < 0 {
+		length = hasher.Size()
+	}
+	if length < MinDigestLength {
+		return fmt.Errorf("%w: %d byte digest is shorter than %d", UnsupportedPrefixError, length, MinDigestLength)
+	}
+	return nil
+}
+
+func cryptographicMultihash(code uint64) bool {
+	switch code {
+	case mh.SHA2_256, mh.SHA2_512, mh.SHA3_224, mh.SHA3_256, mh.SHA3_384, mh.SHA3_512, mh.BLAKE3:
+		return true
+	}
+	return (code >= mh.BLAKE2B_MIN && code <= mh.BLAKE2B_MAX) ||
+		(code >= mh.BLAKE2S_MIN && code <= mh.BLAKE2S_MAX)
+}
+
+var _ UcanStore = &VerifyingStore{}
+var _ ContextUcanStore = &VerifyingStore{}
+
+// VerifyingStore checks that the ucans read from a store match their cids and
+// that ucans are written with a supported prefix under the expected cid, so a
+// corrupted or tampered store can not feed foreign ucans into proof chains.
+type VerifyingStore struct {
+	store ContextUcanStore
+}
+
+func NewVerifyingStore(store UcanStore) *VerifyingStore {
+	return &VerifyingStore{NewContextStore(store)}
+}
+
+func (vs *VerifyingStore) ReadUcan(c cid.Cid) (*Ucan, error) {
+	return vs.ReadUcanContext(context.Background(), c)
+}
+
+func (vs *VerifyingStore) WriteUcan(uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	return vs.WriteUcanContext(context.Background(), uc, prefix)
+}
+
+func (vs *VerifyingStore) ReadUcanStr(c cid.Cid) (string, error) {
+	return vs.ReadUcanStrContext(context.Background(), c)
+}
+
+func (vs *VerifyingStore) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
+	return vs.WriteUcanStrContext(context.Background(), str, prefix)
+}
+
+func (vs *VerifyingStore) ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	str, err := vs.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeUcanString(str)
+}
+
+func (vs *VerifyingStore) WriteUcanContext(ctx context.Context, uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	str, err := uc.Encode()
+	if err != nil {
+		return cid.Undef, err
+	}
+	return vs.WriteUcanStrContext(ctx, str, prefix)
+}
+
+func (vs *VerifyingStore) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	str, err := vs.store.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	err = VerifyUcanCid(c, str)
+	if err != nil {
+		return "", err
+	}
+	return str, nil
+}
+
+func (vs *VerifyingStore) WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error) {
+	if prefix == nil {
+		prefix = &DefaultPrefix
+	}
+	err := CheckPrefix(prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	expected, err := prefix.Sum([]byte(str))
+	if err != nil {
+		return cid.Undef, err
+	}
+	c, err := vs.store.WriteUcanStrContext(ctx, str, prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if !c.Equals(expected) {
+		return cid.Undef, fmt.Errorf("%w: store wrote %s instead of %s", UcanCidMismatchError, c.String(), expected.String())
+	}
+	return c, nil
+}
@@ -0,0 +1,106 @@
+package ucan
+
+import (
+	"context"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// tamperedStore serves other ucans than the ones written to it
+type tamperedStore struct {
+	*MemoryStore
+	replacement string
+}
+
+func (s *tamperedStore) ReadUcanStr(c cid.Cid) (string, error) {
+	if _, err := s.MemoryStore.ReadUcanStr(c); err != nil {
+		return "", err
+	}
+	return s.replacement, nil
+}
+
+func (s *tamperedStore) ReadUcanStrContext(_ context.Context, c cid.Cid) (string, error) {
+	return s.ReadUcanStr(c)
+}
+
+func TestVerifiesUcansOfAnyPrefix(t *testing.T) {
+	store := NewVerifyingStore(NewMemoryStore())
+	uc := buildLeaf(t, 60)
+	for _, prefix := range []*cid.Prefix{
+		nil,
+		{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_512, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.SHA3_256, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.BLAKE2B_MIN + 31, MhLength: -1},
+	} {
+		c, err := store.WriteUcan(uc, prefix)
+		assert.NoError(t, err)
+		read, err := store.ReadUcan(c)
+		assert.NoError(t, err)
+		assert.Equal(t, uc, read)
+	}
+
+	for _, prefix := range []*cid.Prefix{
+		{Version: 1, Codec: cid.Raw, MhType: mh.IDENTITY, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.MURMUR3X64_64, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: 16},
+		{Version: 1, Codec: cid.Raw, MhType: mh.BLAKE2S_MIN + 15, MhLength: -1},
+	} {
+		_, err := store.WriteUcan(uc, prefix)
+		assert.ErrorIs(t, err, UnsupportedPrefixError)
+	}
+	str, err := uc.Encode()
+	assert.NoError(t, err)
+	_, err = store.WriteUcanStr(str, &cid.Prefix{Version: 1, Codec: cid.DagJSON, MhType: mh.SHA2_256, MhLength: -1})
+	assert.ErrorIs(t, err, UnsupportedPrefixError)
+}
+
+func TestRejectsTamperedStores(t *testing.T) {
+	replacement, err := buildLeaf(t, 60).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := &tamperedStore{MemoryStore: NewMemoryStore(), replacement: replacement}
+	leaf := buildLeaf(t, 60)
+	c, err := tampered.WriteUcan(leaf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewVerifyingStore(tampered).ReadUcan(c)
+	assert.ErrorIs(t, err, UcanCidMismatchError)
+
+	_, err = ProofChainFromUcanCid(c, nil, tampered)
+	assert.ErrorIs(t, err, UcanCidMismatchError)
+
+	uc, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(leaf, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ProofChainFromUcan(uc, nil, tampered)
+	assert.ErrorIs(t, err, UcanCidMismatchError)
+}
+
+func TestCheckPrefix(t *testing.T) {
+	assert.NoError(t, CheckPrefix(&DefaultPrefix))
+	assert.NoError(t, CheckPrefix(&cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: 32}))
+
+	for _, prefix := range []*cid.Prefix{
+		{Version: 1, Codec: cid.Raw, MhType: mh.MURMUR3X64_64, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.IDENTITY, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.SHA1, MhLength: -1},
+		{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: 20},
+		{Version: 1, Codec: cid.DagJSON, MhType: mh.SHA2_256, MhLength: -1},
+		{Version: 0, Codec: cid.DagProtobuf, MhType: mh.SHA2_256, MhLength: -1},
+	} {
+		assert.ErrorIs(t, CheckPrefix(prefix), UnsupportedPrefixError, mh.Codes[prefix.MhType])
+	}
+}
@@ -0,0 +1,167 @@
+// Package ipfsstore keeps ucans as raw blocks of an IPFS blockstore, so they
+// are stored, pinned and replicated alongside other content. The default
+// prefix of ucans, raw codec BLAKE3 CIDv1, is understood by IPFS.
+package ipfsstore
+
+import (
+	"context"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+var _ ucan.EnumerableUcanStore = &Store{}
+var _ ucan.ContextUcanStore = &Store{}
+
+// Store adapts a blockstore to UcanStore, blocks read from it are checked
+// against their cid
+type Store struct {
+	bs blockstore.Blockstore
+}
+
+func New(bs blockstore.Blockstore) *Store {
+	return &Store{bs}
+}
+
+// NewFromDatastore stores ucans in ds under the /blocks prefix, like IPFS nodes
+func NewFromDatastore(ds datastore.Batching) *Store {
+	return &Store{blockstore.NewBlockstore(ds)}
+}
+
+// Blockstore returns the underlying blockstore
+func (s *Store) Blockstore() blockstore.Blockstore {
+	return s.bs
+}
+
+// DecodeBlock decodes a block fetched from IPFS as ucan after checking it
+// against its cid
+func DecodeBlock(blk blocks.Block) (*ucan.Ucan, error) {
+	ucanStr := string(blk.RawData())
+	err := ucan.VerifyUcanCid(blk.Cid(), ucanStr)
+	if err != nil {
+		return nil, err
+	}
+	return ucan.DecodeUcanString(ucanStr)
+}
+
+func (s *Store) ReadUcan(c cid.Cid) (*ucan.Ucan, error) {
+	return s.ReadUcanContext(context.Background(), c)
+}
+
+func (s *Store) WriteUcan(uc *ucan.Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	return s.WriteUcanContext(context.Background(), uc, prefix)
+}
+
+func (s *Store) ReadUcanStr(c cid.Cid) (string, error) {
+	return s.ReadUcanStrContext(context.Background(), c)
+}
+
+func (s *Store) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
+	return s.WriteUcanStrContext(context.Background(), str, prefix)
+}
+
+func (s *Store) ReadUcanContext(ctx context.Context, c cid.Cid) (*ucan.Ucan, error) {
+	str, err := s.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return ucan.DecodeUcanString(str)
+}
+
+func (s *Store) WriteUcanContext(ctx context.Context, uc *ucan.Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	c, str, err := uc.ToCid(prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, s.put(ctx, c, str)
+}
+
+func (s *Store) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	blk, err := s.bs.Get(ctx, c)
+	if format.IsNotFound(err) {
+		return "", fmt.Errorf("%w: %s", ucan.UcanNotFoundError, c.String())
+	}
+	if err != nil {
+		return "", err
+	}
+	str := string(blk.RawData())
+	err = ucan.VerifyUcanCid(c, str)
+	if err != nil {
+		return "", err
+	}
+	return str, nil
+}
+
+func (s *Store) WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error) {
+	_, err := ucan.DecodeUcanString(str)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if prefix == nil {
+		prefix = &ucan.DefaultPrefix
+	}
+	c, err := prefix.Sum([]byte(str))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, s.put(ctx, c, str)
+}
+
+func (s *Store) put(ctx context.Context, c cid.Cid, str string) error {
+	prefix := c.Prefix()
+	err := ucan.CheckPrefix(&prefix)
+	if err != nil {
+		return err
+	}
+	blk, err := blocks.NewBlockWithCid([]byte(str), c)
+	if err != nil {
+		return err
+	}
+	return s.bs.Put(ctx, blk)
+}
+
+func (s *Store) Has(c cid.Cid) (bool, error) {
+	return s.bs.Has(context.Background(), c)
+}
+
+// Delete removes the block of c, deleting a missing block is not an error
+func (s *Store) Delete(c cid.Cid) error {
+	err := s.bs.DeleteBlock(context.Background(), c)
+	if format.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the cids of the blocks which are ucans, other content of the
+// blockstore is skipped
+func (s *Store) List() ([]cid.Cid, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	keys, err := s.bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cids := make([]cid.Cid, 0)
+	for c := range keys {
+		if c.Prefix().Codec != cid.Raw {
+			continue
+		}
+		blk, err := s.bs.Get(ctx, c)
+		if format.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := DecodeBlock(blk); err == nil {
+			cids = append(cids, c)
+		}
+	}
+	return cids, nil
+}
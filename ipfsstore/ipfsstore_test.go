@@ -0,0 +1,99 @@
+package ipfsstore
+
+import (
+	"context"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newStore() *Store {
+	return NewFromDatastore(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func buildUcan(t *testing.T) *ucan.Ucan {
+	uc, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		WithNonce().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uc
+}
+
+func TestStoresUcansAsBlocks(t *testing.T) {
+	store := newStore()
+	ctx := context.Background()
+	uc := buildUcan(t)
+	c, err := store.WriteUcan(uc, nil)
+	assert.NoError(t, err)
+
+	blk, err := store.Blockstore().Get(ctx, c)
+	assert.NoError(t, err)
+	decoded, err := DecodeBlock(blk)
+	assert.NoError(t, err)
+	assert.Equal(t, uc, decoded)
+	read, err := store.ReadUcan(c)
+	assert.NoError(t, err)
+	assert.Equal(t, uc, read)
+
+	content := blocks.NewBlock([]byte("not a ucan"))
+	assert.NoError(t, store.Blockstore().Put(ctx, content))
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{c}, cids)
+
+	assert.NoError(t, store.Delete(c))
+	assert.NoError(t, store.Delete(c))
+	has, err := store.Has(c)
+	assert.NoError(t, err)
+	assert.False(t, has)
+	_, err = store.ReadUcanStr(c)
+	assert.ErrorIs(t, err, ucan.UcanNotFoundError)
+}
+
+func TestResolvesProofChains(t *testing.T) {
+	store := newStore()
+	grant := buildUcan(t)
+	_, err := store.WriteUcan(grant, nil)
+	assert.NoError(t, err)
+	leaf, err := ucan.DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := store.WriteUcan(leaf, nil)
+	assert.NoError(t, err)
+
+	_, err = ucan.ProofChainFromUcanCid(c, nil, store)
+	assert.NoError(t, err)
+}
+
+func TestRejectsTamperedBlocks(t *testing.T) {
+	store := newStore()
+	c, err := store.WriteUcan(buildUcan(t), nil)
+	assert.NoError(t, err)
+	other, err := buildUcan(t).Encode()
+	assert.NoError(t, err)
+
+	tampered, err := blocks.NewBlockWithCid([]byte(other), c)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Blockstore().DeleteBlock(context.Background(), c))
+	assert.NoError(t, store.Blockstore().Put(context.Background(), tampered))
+	_, err = store.ReadUcanStr(c)
+	assert.ErrorIs(t, err, ucan.UcanCidMismatchError)
+	_, err = DecodeBlock(tampered)
+	assert.ErrorIs(t, err, ucan.UcanCidMismatchError)
+}
@@ -54,7 +54,6 @@ type DidKeyPair struct {
 }
 
 func NewDidKeyPairFromPrivateKeyString(str string) (*DidKeyPair, error) {
-	dkp := &DidKeyPair{}
 	privKeyBytes, err := base64.StdEncoding.DecodeString(str)
 	if err != nil {
 		return nil, err
@@ -63,6 +62,12 @@ func NewDidKeyPairFromPrivateKeyString(str string) (*DidKeyPair, error) {
 	if err != nil {
 		return nil, err
 	}
+	return NewDidKeyPair(privKey)
+}
+
+// NewDidKeyPair signs with a libp2p private key, e.g. the identity of a libp2p host
+func NewDidKeyPair(privKey crypto.PrivKey) (*DidKeyPair, error) {
+	dkp := &DidKeyPair{}
 	rawPrivBytes, err := privKey.Raw()
 	if err != nil {
 		return nil, fmt.Errorf("getting private key bytes: %w", err)
@@ -80,8 +85,18 @@ func NewDidKeyPairFromPrivateKeyString(str string) (*DidKeyPair, error) {
 		}
 	case crypto.Ed25519:
 		methodStr = "EdDSA"
+		if len(rawPrivBytes) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid ed25519 private key length: %d", len(rawPrivBytes))
+		}
+		dkp.signKey = ed25519.PrivateKey(rawPrivBytes)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
 	}
 
+	dkp.verifyKey, err = dkp.getVerifyKey()
+	if err != nil {
+		return nil, err
+	}
 	dkp.SigningMethod = jwt.GetSigningMethod(methodStr)
 	// todo string
 
@@ -126,6 +141,8 @@ func ParseDidStringAndGetVertifyKey(did string) (*DidKeyPair, error) {
 			return nil, err
 		}
 		key.pubKey = pub
+	default:
+		return nil, fmt.Errorf("unsupported did:key type: 0x%x", keyType)
 	}
 
 	verifyKey, err := key.getVerifyKey()
@@ -141,6 +158,9 @@ func (dkp *DidKeyPair) DidString() (string, error) {
 	if dkp.DIDString != "" {
 		return dkp.DIDString, nil
 	}
+	if dkp.pubKey == nil {
+		return "", fmt.Errorf("key pair without public key")
+	}
 
 	var multiCodec uint64
 	switch dkp.pubKey.Type() {
@@ -149,7 +169,7 @@ func (dkp *DidKeyPair) DidString() (string, error) {
 	case crypto.Ed25519:
 		multiCodec = MulticodecKindEd25519PubKey
 	default:
-		panic("unexpected crypto type")
+		return "", fmt.Errorf("unsupported key type: %s", dkp.pubKey.Type())
 	}
 
 	raw, err := dkp.pubKey.Raw()
@@ -173,6 +193,11 @@ func (dkp *DidKeyPair) DidString() (string, error) {
 	return dkp.DIDString, nil
 }
 
+// PubKey returns the libp2p public key of the did
+func (dkp *DidKeyPair) PubKey() crypto.PubKey {
+	return dkp.pubKey
+}
+
 func (dkp *DidKeyPair) GetJwtAlgorithmName() string {
 	return dkp.Alg()
 }
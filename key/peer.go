@@ -0,0 +1,32 @@
+package key
+
+import (
+	"fmt"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DidFromPubKey returns the did:key of a libp2p public key
+func DidFromPubKey(pub crypto.PubKey) (string, error) {
+	return (&DidKeyPair{pubKey: pub}).DidString()
+}
+
+// DidFromPeerID returns the did:key of a peer whose id embeds its public key,
+// like the ids of ed25519 peers. Ids of rsa peers are hashes of their keys,
+// use DidFromPubKey with the key of the peerstore or connection for them.
+func DidFromPeerID(id peer.ID) (string, error) {
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return "", fmt.Errorf("can not extract public key of peer %s: %w", id, err)
+	}
+	return DidFromPubKey(pub)
+}
+
+// PeerIDFromDid returns the libp2p peer id of a did:key
+func PeerIDFromDid(did string) (peer.ID, error) {
+	dkp, err := ParseDidStringAndGetVertifyKey(did)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPublicKey(dkp.pubKey)
+}
@@ -0,0 +1,290 @@
+// Package p2pauth authorizes libp2p streams with ucans. Before a protocol
+// handler runs, the remote peer sends a ucan issued by its own did and
+// addressed to the did of the local peer, granting p2p://<local peer>/<protocol>.
+package p2pauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/key"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	varint "github.com/multiformats/go-varint"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAbility is required to open streams of a protocol
+	DefaultAbility = "p2p/stream"
+	// MaxMessageSize bounds the size of a ucan and its proofs sent before a stream
+	MaxMessageSize = 1 << 20
+	// DefaultTimeout bounds how long a peer may take to authorize a stream
+	DefaultTimeout = 10 * time.Second
+)
+
+var (
+	WrongIssuerError = fmt.Errorf("ucan is not issued by the remote peer")
+	RejectedError    = fmt.Errorf("stream rejected")
+)
+
+// Semantics understands p2p:// resources with any namespaced ability
+var Semantics = capability.CapabilitySemantics[ProtocolScope, Ability]{}
+
+var _ capability.Scope = &ProtocolScope{}
+
+// ProtocolScope is a p2p://<peer>/<protocol> resource, protocols contain the
+// protocols below them and p2p://<peer> contains every protocol of the peer.
+// Peer ids and protocols are case sensitive.
+type ProtocolScope struct {
+	peer     string
+	protocol string
+}
+
+func (s ProtocolScope) Contains(other capability.Scope) bool {
+	otherScope, ok := other.(*ProtocolScope)
+	if !ok || s.peer != otherScope.peer {
+		return false
+	}
+	return s.protocol == "/" || s.protocol == otherScope.protocol || strings.HasPrefix(otherScope.protocol, s.protocol+"/")
+}
+
+func (s ProtocolScope) ParseScope(url url.URL) (capability.Scope, error) {
+	if url.Scheme != "p2p" || url.Host == "" || url.User != nil || url.RawQuery != "" || url.Fragment != "" {
+		return nil, fmt.Errorf("cannot interpret URI as p2p resource: %s", url.String())
+	}
+	if _, err := peer.Decode(url.Host); err != nil {
+		return nil, fmt.Errorf("invalid peer id in %s: %w", url.String(), err)
+	}
+	proto := strings.TrimSuffix(url.Path, "/")
+	if proto == "" {
+		proto = "/"
+	}
+	for _, seg := range strings.Split(proto, "/") {
+		if seg == "." || seg == ".." {
+			return nil, fmt.Errorf("invalid protocol in %s", url.String())
+		}
+	}
+	return &ProtocolScope{peer: url.Host, protocol: proto}, nil
+}
+
+func (s ProtocolScope) ToString() string {
+	if s.protocol == "/" {
+		return "p2p://" + s.peer
+	}
+	return "p2p://" + s.peer + s.protocol
+}
+
+// Ability is any namespaced ability
+type Ability = capability.NamespacedAbility[capability.NoImplications]
+
+// ProtocolCapability returns the capability needed to open streams of proto on peer
+func ProtocolCapability(p peer.ID, proto protocol.ID, ability string) (*capability.Capability, error) {
+	return capability.BuildCapability("p2p://"+p.String()+string(proto), ability, capability.NullJson)
+}
+
+// request is sent by the remote peer before the stream is handed to the protocol
+type request struct {
+	Ucan   string   `json:"ucan"`
+	Proofs []string `json:"proofs,omitempty"`
+}
+
+// response accepts the stream when Error is empty
+type response struct {
+	Error string `json:"error,omitempty"`
+}
+
+// StreamHandler handles a stream together with the verified capability
+type StreamHandler func(s network.Stream, capInfo *ucan.CapabilityInfo)
+
+// Guard wraps the stream handlers of a host, the authorizer must have the did
+// of the host as audience, see NewAuthorizer.
+type Guard struct {
+	authorizer *ucan.Authorizer
+	local      peer.ID
+	ability    string
+	timeout    time.Duration
+}
+
+// NewAuthorizer returns an authorizer for ucans addressed to the host
+func NewAuthorizer(h host.Host) (*ucan.Authorizer, error) {
+	did, err := key.DidFromPubKey(h.Peerstore().PubKey(h.ID()))
+	if err != nil {
+		return nil, err
+	}
+	return ucan.NewAuthorizer(did, Semantics), nil
+}
+
+func NewGuard(h host.Host, authorizer *ucan.Authorizer) *Guard {
+	return &Guard{
+		authorizer: authorizer,
+		local:      h.ID(),
+		ability:    DefaultAbility,
+		timeout:    DefaultTimeout,
+	}
+}
+
+// WithAbility sets the ability required to open streams
+func (g *Guard) WithAbility(ability string) *Guard {
+	g.ability = ability
+	return g
+}
+
+// WithTimeout bounds how long a peer may take to authorize a stream
+func (g *Guard) WithTimeout(timeout time.Duration) *Guard {
+	g.timeout = timeout
+	return g
+}
+
+// Handler only calls next for streams authorized by the remote peer, other
+// streams are answered with the reason of the rejection and closed.
+func (g *Guard) Handler(next StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		capInfo, err := g.authorize(s)
+		resp := response{}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		_ = s.SetDeadline(time.Now().Add(g.timeout))
+		writeErr := writeMessage(s, &resp)
+		_ = s.SetDeadline(time.Time{})
+		if writeErr != nil {
+			_ = s.Reset()
+			return
+		}
+		if err != nil {
+			// closing instead of resetting lets the peer read the rejection
+			_ = s.Close()
+			return
+		}
+		next(s, capInfo)
+	}
+}
+
+func (g *Guard) authorize(s network.Stream) (*ucan.CapabilityInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+	_ = s.SetReadDeadline(time.Now().Add(g.timeout))
+	defer s.SetReadDeadline(time.Time{})
+
+	req := request{}
+	err := readMessage(s, &req)
+	if err != nil {
+		return nil, err
+	}
+	uc, err := ucan.DecodeUcanString(req.Ucan)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := key.DidFromPubKey(s.Conn().RemotePublicKey())
+	if err != nil {
+		return nil, err
+	}
+	if uc.Issuer() != remote {
+		return nil, fmt.Errorf("%w: issuer is %s", WrongIssuerError, uc.Issuer())
+	}
+	required, err := ProtocolCapability(g.local, s.Protocol(), g.ability)
+	if err != nil {
+		return nil, err
+	}
+	return g.authorizer.AuthorizeUcan(ctx, uc, req.Proofs, required)
+}
+
+// Authorize sends the ucan and its proofs over a freshly opened stream and
+// waits for the remote peer to accept it.
+func Authorize(s network.Stream, uc *ucan.Ucan, proofs ...*ucan.Ucan) error {
+	req := request{Proofs: make([]string, 0, len(proofs))}
+	var err error
+	req.Ucan, err = uc.Encode()
+	if err != nil {
+		return err
+	}
+	for _, prf := range proofs {
+		encoded, err := prf.Encode()
+		if err != nil {
+			return err
+		}
+		req.Proofs = append(req.Proofs, encoded)
+	}
+	err = writeMessage(s, &req)
+	if err != nil {
+		return err
+	}
+
+	resp := response{}
+	err = readMessage(s, &resp)
+	if err != nil {
+		return fmt.Errorf("%w: %v", RejectedError, err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%w: %s", RejectedError, resp.Error)
+	}
+	return nil
+}
+
+// NewStream opens an authorized stream of proto to p
+func NewStream(ctx context.Context, h host.Host, p peer.ID, proto protocol.ID, uc *ucan.Ucan, proofs ...*ucan.Ucan) (network.Stream, error) {
+	s, err := h.NewStream(ctx, p, proto)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+	err = Authorize(s, uc, proofs...)
+	if err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	_ = s.SetDeadline(time.Time{})
+	return s, nil
+}
+
+// writeMessage writes a varint length prefixed json message
+func writeMessage(w io.Writer, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(varint.ToUvarint(uint64(len(data))), data...))
+	return err
+}
+
+// readMessage reads a single message without consuming the bytes following it
+func readMessage(r io.Reader, msg interface{}) error {
+	size, err := varint.ReadUvarint(&byteReader{r: r})
+	if err != nil {
+		return err
+	}
+	if size > MaxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds %d bytes", size, MaxMessageSize)
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, msg)
+}
+
+// byteReader reads varints byte by byte, so the protocol data behind a message stays on the stream
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(br.r, br.buf[:])
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return br.buf[0], err
+}
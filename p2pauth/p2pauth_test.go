@@ -0,0 +1,166 @@
+package p2pauth
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/capability"
+	"github.com/KenCloud-Tech/go-ucan-kc/key"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+const echoProtocol = protocol.ID("/echo/1.0.0")
+
+type testPeer struct {
+	host host.Host
+	key  *key.DidKeyPair
+	did  string
+}
+
+// newPeers links in memory hosts with ed25519 identities
+func newPeers(t *testing.T, n int) []testPeer {
+	mn := mocknet.New()
+	t.Cleanup(func() {
+		_ = mn.Close()
+	})
+	peers := make([]testPeer, n)
+	for i := range peers {
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := mn.AddPeer(priv, ma.StringCast(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 4001+i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dkp, err := key.NewDidKeyPair(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		did, err := key.DidFromPeerID(h.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers[i] = testPeer{host: h, key: dkp, did: did}
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	return peers
+}
+
+func grant(t *testing.T, issuer testPeer, audience testPeer, resource string, proofs ...*ucan.Ucan) *ucan.Ucan {
+	builder := ucan.DefaultBuilder().
+		IssuedBy(issuer.key).
+		ForAudience(audience.did).
+		WithLifetime(60)
+	for _, prf := range proofs {
+		builder = builder.DelegatingFrom(prf, nil)
+	}
+	if len(proofs) == 0 {
+		builder = builder.ClaimingCapability(capability.NewCapability(resource, DefaultAbility, capability.NullJson))
+	}
+	uc, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uc
+}
+
+func serveEcho(t *testing.T, server testPeer) chan *ucan.CapabilityInfo {
+	authorizer, err := NewAuthorizer(server.host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := make(chan *ucan.CapabilityInfo, 1)
+	server.host.SetStreamHandler(echoProtocol, NewGuard(server.host, authorizer).Handler(
+		func(s network.Stream, capInfo *ucan.CapabilityInfo) {
+			defer s.Close()
+			verified <- capInfo
+			_, _ = io.Copy(s, s)
+		}))
+	return verified
+}
+
+func TestAuthorizesStreamsOfDelegatedPeers(t *testing.T) {
+	peers := newPeers(t, 3)
+	server, alice, mallory := peers[0], peers[1], peers[2]
+	verified := serveEcho(t, server)
+
+	resource := "p2p://" + server.host.ID().String() + "/echo"
+	serverGrant := grant(t, server, alice, resource)
+	invocation := grant(t, alice, server, "", serverGrant)
+
+	s, err := NewStream(context.Background(), alice.host, server.host.ID(), echoProtocol, invocation, serverGrant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.CloseWrite())
+	echoed, err := io.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(echoed))
+	capInfo := <-verified
+	assert.True(t, capInfo.Originators[server.did])
+
+	// the ucan of alice can not be replayed by mallory
+	_, err = NewStream(context.Background(), mallory.host, server.host.ID(), echoProtocol, invocation, serverGrant)
+	assert.ErrorIs(t, err, RejectedError)
+	assert.ErrorContains(t, err, WrongIssuerError.Error())
+}
+
+func TestRejectsStreamsOfOtherProtocols(t *testing.T) {
+	peers := newPeers(t, 2)
+	server, alice := peers[0], peers[1]
+	serveEcho(t, server)
+
+	serverGrant := grant(t, server, alice, "p2p://"+server.host.ID().String()+"/chat")
+	invocation := grant(t, alice, server, "", serverGrant)
+	_, err := NewStream(context.Background(), alice.host, server.host.ID(), echoProtocol, invocation, serverGrant)
+	assert.ErrorIs(t, err, RejectedError)
+	assert.ErrorContains(t, err, ucan.NotAuthorizedError.Error())
+
+	selfIssued := grant(t, alice, server, "p2p://"+server.host.ID().String())
+	_, err = NewStream(context.Background(), alice.host, server.host.ID(), echoProtocol, selfIssued)
+	assert.ErrorIs(t, err, RejectedError)
+}
+
+func TestProtocolScopes(t *testing.T) {
+	peers := newPeers(t, 1)
+	id := peers[0].host.ID()
+
+	parse := func(proto protocol.ID) *capability.CapabilityView {
+		required, err := ProtocolCapability(id, proto, DefaultAbility)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cv, err := Semantics.ParseCapability(required)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cv
+	}
+	all, echo, echoV1, echoes := parse(""), parse("/echo"), parse(echoProtocol), parse("/echoes")
+
+	assert.True(t, all.Enables(echoV1))
+	assert.True(t, echo.Enables(echoV1))
+	assert.False(t, echo.Enables(echoes))
+	assert.False(t, echoV1.Enables(echo))
+	assert.Equal(t, "p2p://"+id.String(), all.Resource.ToString())
+
+	_, err := Semantics.ParseCapability(capability.NewCapability("p2p://not-a-peer/echo", DefaultAbility, capability.NullJson))
+	assert.Error(t, err)
+}
@@ -0,0 +1,308 @@
+// Package proofsync exchanges ucan proofs between libp2p peers. A verifier asks
+// a peer for a set of cids, or for the whole chains under them, and writes the
+// ucans it receives into its store after checking their cids, signatures and
+// time bounds.
+package proofsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	msgio "github.com/libp2p/go-msgio"
+	"time"
+)
+
+const (
+	ProtocolID = protocol.ID("/ucan/proofs/1.0.0")
+	// MaxCids bounds the number of cids of a request
+	MaxCids = 64
+	// MaxUcans bounds the number of ucans of a response
+	MaxUcans = 256
+	// MaxMessageSize bounds the size of requests and responses
+	MaxMessageSize = 4 << 20
+	// DefaultTimeout bounds how long a peer may take to send its request
+	DefaultTimeout = 10 * time.Second
+
+	// responseOverhead is the encoded size of an empty response, with room to spare
+	responseOverhead = 64
+)
+
+var (
+	TooManyCidsError = fmt.Errorf("too many cids requested")
+	RemoteError      = fmt.Errorf("remote peer failed")
+)
+
+// request asks for the ucans of Cids, with Chain also for all their proofs
+type request struct {
+	Cids  []string `json:"cids"`
+	Chain bool     `json:"chain,omitempty"`
+}
+
+// response holds the ucans by cid, cids the peer does not know are missing
+type response struct {
+	Ucans   map[string]string `json:"ucans,omitempty"`
+	Missing []string          `json:"missing,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// Service answers proof requests from the ucans of a store
+type Service struct {
+	store    ucan.ContextUcanStore
+	maxCids  int
+	maxUcans int
+	maxSize  int
+	timeout  time.Duration
+}
+
+func NewService(store ucan.UcanStore) *Service {
+	return &Service{
+		store:    ucan.NewContextStore(store),
+		maxCids:  MaxCids,
+		maxUcans: MaxUcans,
+		maxSize:  MaxMessageSize,
+		timeout:  DefaultTimeout,
+	}
+}
+
+// WithMaxCids bounds the number of cids of a request
+func (s *Service) WithMaxCids(n int) *Service {
+	s.maxCids = n
+	return s
+}
+
+// WithMaxUcans bounds the number of ucans of a response, the chains of larger
+// requests are truncated and reported as missing
+func (s *Service) WithMaxUcans(n int) *Service {
+	s.maxUcans = n
+	return s
+}
+
+// WithMaxResponseSize bounds the encoded size of a response, at most
+// MaxMessageSize, ucans which do not fit are reported as missing
+func (s *Service) WithMaxResponseSize(n int) *Service {
+	if n > MaxMessageSize {
+		n = MaxMessageSize
+	}
+	s.maxSize = n
+	return s
+}
+
+// WithTimeout bounds how long a peer may take to send its request and read the response
+func (s *Service) WithTimeout(timeout time.Duration) *Service {
+	s.timeout = timeout
+	return s
+}
+
+// Register serves proof requests on h
+func (s *Service) Register(h host.Host) {
+	h.SetStreamHandler(ProtocolID, s.Handler())
+}
+
+func (s *Service) Handler() network.StreamHandler {
+	return func(str network.Stream) {
+		defer str.Close()
+		_ = str.SetDeadline(time.Now().Add(s.timeout))
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+
+		resp := s.respond(ctx, str)
+		err := writeMessage(msgio.NewVarintWriter(str), resp)
+		if err != nil {
+			_ = str.Reset()
+		}
+	}
+}
+
+func (s *Service) respond(ctx context.Context, str network.Stream) *response {
+	req := request{}
+	err := readMessage(msgio.NewVarintReaderSize(str, MaxMessageSize), &req)
+	if err != nil {
+		return &response{Error: err.Error()}
+	}
+	if len(req.Cids) > s.maxCids {
+		return &response{Error: fmt.Sprintf("%s: %d cids exceed %d", TooManyCidsError.Error(), len(req.Cids), s.maxCids)}
+	}
+
+	// size tracks the encoded size of resp, missing cids which do not fit are
+	// left out as the requester derives what is missing from its own walk
+	resp := &response{Ucans: make(map[string]string)}
+	size := responseOverhead
+	missing := func(cidStr string) {
+		if entry := len(cidStr) + 3; size+entry <= s.maxSize {
+			resp.Missing = append(resp.Missing, cidStr)
+			size += entry
+		}
+	}
+	pending := append([]string(nil), req.Cids...)
+	seen := make(map[string]bool)
+	for len(pending) > 0 {
+		cidStr := pending[0]
+		pending = pending[1:]
+		if seen[cidStr] {
+			continue
+		}
+		seen[cidStr] = true
+		if len(resp.Ucans) >= s.maxUcans {
+			missing(cidStr)
+			continue
+		}
+
+		c, err := cid.Decode(cidStr)
+		if err != nil {
+			return &response{Error: err.Error()}
+		}
+		ucanStr, err := s.store.ReadUcanStrContext(ctx, c)
+		if err != nil {
+			if ctx.Err() != nil {
+				return &response{Error: ctx.Err().Error()}
+			}
+			missing(cidStr)
+			continue
+		}
+		entry := len(cidStr) + len(ucanStr) + 6
+		if size+entry > s.maxSize {
+			missing(cidStr)
+			continue
+		}
+		resp.Ucans[cidStr] = ucanStr
+		size += entry
+		if !req.Chain {
+			continue
+		}
+		uc, err := ucan.DecodeUcanString(ucanStr)
+		if err != nil {
+			continue
+		}
+		pending = append(pending, uc.Proofs()...)
+	}
+	return resp
+}
+
+// Result reports the cids written into the store and the cids the peer did not send
+type Result struct {
+	Written []cid.Cid
+	Missing []cid.Cid
+}
+
+// Fetch asks p for the ucans of cids and writes them into store
+func Fetch(ctx context.Context, h host.Host, p peer.ID, store ucan.UcanStore, cids ...cid.Cid) (*Result, error) {
+	return fetch(ctx, h, p, store, false, cids)
+}
+
+// FetchChain asks p for the ucans of cids and all their proofs and writes them
+// into store, so proof chains under cids can be built from store
+func FetchChain(ctx context.Context, h host.Host, p peer.ID, store ucan.UcanStore, cids ...cid.Cid) (*Result, error) {
+	return fetch(ctx, h, p, store, true, cids)
+}
+
+func fetch(ctx context.Context, h host.Host, p peer.ID, store ucan.UcanStore, chain bool, cids []cid.Cid) (*Result, error) {
+	if len(cids) > MaxCids {
+		return nil, fmt.Errorf("%w: %d cids exceed %d", TooManyCidsError, len(cids), MaxCids)
+	}
+	req := request{Cids: make([]string, len(cids)), Chain: chain}
+	for i, c := range cids {
+		req.Cids[i] = c.String()
+	}
+
+	str, err := h.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer str.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = str.SetDeadline(deadline)
+	}
+	err = writeMessage(msgio.NewVarintWriter(str), &req)
+	if err != nil {
+		_ = str.Reset()
+		return nil, err
+	}
+	_ = str.CloseWrite()
+	resp := response{}
+	err = readMessage(msgio.NewVarintReaderSize(str, MaxMessageSize), &resp)
+	if err != nil {
+		_ = str.Reset()
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%w: %s", RemoteError, resp.Error)
+	}
+	return accept(ctx, store, &resp, chain, cids)
+}
+
+// accept writes the ucans of resp reachable from cids into store, ucans which
+// were not asked for are ignored so a peer can not fill the store with them.
+// Ucans must match their cid, carry a valid signature and be within their
+// time bounds, otherwise nothing more is written.
+func accept(ctx context.Context, store ucan.UcanStore, resp *response, chain bool, cids []cid.Cid) (*Result, error) {
+	cs := ucan.NewContextStore(store)
+	result := &Result{Written: make([]cid.Cid, 0)}
+	pending := append([]cid.Cid(nil), cids...)
+	seen := make(map[cid.Cid]bool)
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+
+		ucanStr, ok := resp.Ucans[c.String()]
+		if !ok {
+			result.Missing = append(result.Missing, c)
+			continue
+		}
+		err := ucan.VerifyUcanCid(c, ucanStr)
+		if err != nil {
+			return nil, err
+		}
+		uc, err := ucan.DecodeUcanString(ucanStr)
+		if err != nil {
+			return nil, err
+		}
+		err = uc.Validate(nil)
+		if err != nil {
+			return nil, fmt.Errorf("ucan %s: %w", c.String(), err)
+		}
+		prefix := c.Prefix()
+		_, err = cs.WriteUcanStrContext(ctx, ucanStr, &prefix)
+		if err != nil {
+			return nil, err
+		}
+		result.Written = append(result.Written, c)
+		if !chain {
+			continue
+		}
+		for _, prf := range uc.Proofs() {
+			prfCid, err := cid.Decode(prf)
+			if err != nil {
+				return nil, err
+			}
+			pending = append(pending, prfCid)
+		}
+	}
+	return result, nil
+}
+
+func writeMessage(w msgio.WriteCloser, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return w.WriteMsg(data)
+}
+
+func readMessage(r msgio.ReadCloser, msg interface{}) error {
+	data, err := r.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer r.ReleaseMsg(data)
+	return json.Unmarshal(data, msg)
+}
@@ -0,0 +1,179 @@
+package proofsync
+
+import (
+	"context"
+	ucan "github.com/KenCloud-Tech/go-ucan-kc"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHosts(t *testing.T) (host.Host, host.Host) {
+	mn, err := mocknet.FullMeshConnected(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = mn.Close()
+	})
+	hosts := mn.Hosts()
+	return hosts[0], hosts[1]
+}
+
+// chain stores a chain of depth ucans, each witnessing the previous one, and
+// returns their cids from the root to the leaf
+func chain(t *testing.T, store ucan.UcanStore, depth int) []cid.Cid {
+	cids := make([]cid.Cid, 0, depth)
+	var prev *ucan.Ucan
+	for i := 0; i < depth; i++ {
+		builder := ucan.DefaultBuilder().
+			IssuedBy(fixtures.TestIdentities.AliceKey).
+			ForAudience(fixtures.TestIdentities.AliceDidString).
+			WithLifetime(uint64(60 - i)).
+			WithNonce()
+		if prev != nil {
+			builder = builder.WitnessedBy(prev, nil)
+		}
+		uc, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := store.WriteUcan(uc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, c)
+		prev = uc
+	}
+	return cids
+}
+
+func TestFetchesChainsFromPeers(t *testing.T) {
+	server, verifier := newHosts(t)
+	served := ucan.NewMemoryStore()
+	cids := chain(t, served, 3)
+	NewService(served).Register(server)
+	ctx := context.Background()
+
+	local := ucan.NewMemoryStore()
+	leaf := cids[2]
+	result, err := Fetch(ctx, verifier, server.ID(), local, leaf)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{leaf}, result.Written)
+	_, err = ucan.ProofChainFromUcanCid(leaf, nil, local)
+	assert.ErrorIs(t, err, ucan.UcanNotFoundError)
+
+	result, err = FetchChain(ctx, verifier, server.ID(), local, leaf)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{cids[2], cids[1], cids[0]}, result.Written)
+	_, err = ucan.ProofChainFromUcanCid(leaf, nil, local)
+	assert.NoError(t, err)
+
+	unknown := chain(t, ucan.NewMemoryStore(), 1)[0]
+	result, err = Fetch(ctx, verifier, server.ID(), local, unknown)
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{unknown}, result.Missing)
+}
+
+func TestEnforcesRequestLimits(t *testing.T) {
+	server, verifier := newHosts(t)
+	served := ucan.NewMemoryStore()
+	cids := chain(t, served, 3)
+	NewService(served).WithMaxCids(1).WithMaxUcans(2).Register(server)
+	ctx := context.Background()
+
+	_, err := Fetch(ctx, verifier, server.ID(), ucan.NewMemoryStore(), cids[0], cids[1])
+	assert.ErrorIs(t, err, RemoteError)
+	assert.ErrorContains(t, err, TooManyCidsError.Error())
+
+	tooMany := make([]cid.Cid, MaxCids+1)
+	_, err = Fetch(ctx, verifier, server.ID(), ucan.NewMemoryStore(), tooMany...)
+	assert.ErrorIs(t, err, TooManyCidsError)
+
+	result, err := FetchChain(ctx, verifier, server.ID(), ucan.NewMemoryStore(), cids[2])
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{cids[2], cids[1]}, result.Written)
+	assert.Equal(t, []cid.Cid{cids[0]}, result.Missing)
+}
+
+func TestIgnoresUcansNotAskedFor(t *testing.T) {
+	store := ucan.NewMemoryStore()
+	cids := chain(t, ucan.NewMemoryStore(), 2)
+	served := ucan.NewMemoryStore()
+	other := chain(t, served, 1)[0]
+	otherStr, err := served.ReadUcanStr(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := accept(context.Background(), store, &response{Ucans: map[string]string{other.String(): otherStr}}, true, cids[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(result.Written))
+	assert.Equal(t, 0, store.Len())
+
+	_, err = accept(context.Background(), store, &response{Ucans: map[string]string{cids[0].String(): otherStr}}, true, cids[:1])
+	assert.ErrorIs(t, err, ucan.UcanCidMismatchError)
+}
+
+func TestTruncatesResponsesToTheirSize(t *testing.T) {
+	server, verifier := newHosts(t)
+	served := ucan.NewMemoryStore()
+	cids := chain(t, served, 3)
+	leafStr, err := served.ReadUcanStr(cids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewService(served).WithMaxResponseSize(responseOverhead + len(cids[2].String()) + len(leafStr) + 6).Register(server)
+
+	result, err := FetchChain(context.Background(), verifier, server.ID(), ucan.NewMemoryStore(), cids[2])
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{cids[2]}, result.Written)
+	assert.Equal(t, []cid.Cid{cids[1]}, result.Missing)
+}
+
+func TestRejectsInvalidUcans(t *testing.T) {
+	sum := func(str string) cid.Cid {
+		c, err := ucan.DefaultPrefix.Sum([]byte(str))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	build := func(exp int64) string {
+		uc, err := ucan.DefaultBuilder().
+			IssuedBy(fixtures.TestIdentities.AliceKey).
+			ForAudience(fixtures.TestIdentities.BobDidString).
+			WithExpiration(exp).
+			WithNonce().
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		str, err := uc.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return str
+	}
+	store := ucan.NewMemoryStore()
+
+	expired := build(time.Now().Add(-time.Minute).Unix())
+	_, err := accept(context.Background(), store, &response{Ucans: map[string]string{sum(expired).String(): expired}}, false, []cid.Cid{sum(expired)})
+	assert.ErrorIs(t, err, ucan.UcanExpiredError)
+
+	// the signature of another token, under the cid of the forged token
+	valid, other := build(time.Now().Add(time.Minute).Unix()), build(time.Now().Add(time.Minute).Unix())
+	forged := valid[:strings.LastIndex(valid, ".")] + other[strings.LastIndex(other, "."):]
+	_, err = accept(context.Background(), store, &response{Ucans: map[string]string{sum(forged).String(): forged}}, false, []cid.Cid{sum(forged)})
+	assert.Error(t, err)
+	assert.Equal(t, 0, store.Len())
+
+	result, err := accept(context.Background(), store, &response{Ucans: map[string]string{sum(valid).String(): valid}}, false, []cid.Cid{sum(valid)})
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{sum(valid)}, result.Written)
+}
@@ -0,0 +1,300 @@
+package ucan
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNonceSweepInterval = time.Minute
+	// DefaultMaxNonces bounds a MemoryNonceStore, keys of ucans without exp are
+	// never evicted so the bound is what keeps them from growing without limit
+	DefaultMaxNonces = 1 << 20
+)
+
+var (
+	UcanReplayedError    = fmt.Errorf("Replayed")
+	NonceStoreFullError  = fmt.Errorf("nonce store full")
+	NonceStoreStateError = fmt.Errorf("nonce store file unavailable")
+)
+
+// NonceStore remembers the keys of used ucans until they expire
+type NonceStore interface {
+	// Remember records key until expiry, a zero expiry never expires. It returns
+	// false when key is already recorded and has not expired yet.
+	Remember(key string, expiry time.Time) (bool, error)
+}
+
+// ReplayGuard enforces single use of ucans, keyed by issuer and nonce, or by
+// cid for ucans without a nonce. Keys are kept until the ucan expires, after
+// which it is rejected by validation anyway.
+type ReplayGuard struct {
+	store NonceStore
+}
+
+func NewReplayGuard(store NonceStore) *ReplayGuard {
+	return &ReplayGuard{store}
+}
+
+// Check records the ucan as used and fails with UcanReplayedError if it was used before
+func (g *ReplayGuard) Check(uc *Ucan) error {
+	var key string
+	if uc.Nonce() != "" {
+		key = "nnc:" + uc.Issuer() + ":" + uc.Nonce()
+	} else {
+		c, _, err := uc.ToCid(nil)
+		if err != nil {
+			return err
+		}
+		key = "cid:" + c.String()
+	}
+	sum := sha256.Sum256([]byte(key))
+
+	var expiry time.Time
+	if exp := uc.Expires(); exp != nil {
+		expiry = time.Unix(*exp, 0)
+	}
+
+	fresh, err := g.store.Remember(hex.EncodeToString(sum[:]), expiry)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return UcanReplayedError
+	}
+	return nil
+}
+
+var _ NonceStore = &MemoryNonceStore{}
+
+// MemoryNonceStore keeps keys in memory and periodically evicts expired ones.
+// Once it holds max entries, new keys are refused with NonceStoreFullError
+// rather than forgetting unexpired keys, which would let their ucans be replayed.
+type MemoryNonceStore struct {
+	lk         sync.Mutex
+	entries    map[string]time.Time
+	maxEntries int
+	nextSweep  time.Time
+	now        func() time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		entries:    make(map[string]time.Time),
+		maxEntries: DefaultMaxNonces,
+		now:        time.Now,
+	}
+}
+
+// WithMaxEntries bounds the number of keys kept, zero means unbounded
+func (m *MemoryNonceStore) WithMaxEntries(maxEntries int) *MemoryNonceStore {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.maxEntries = maxEntries
+	return m
+}
+
+func (m *MemoryNonceStore) Remember(key string, expiry time.Time) (bool, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	now := m.now()
+	if now.After(m.nextSweep) {
+		evictExpiredNonces(m.entries, now)
+		m.nextSweep = now.Add(defaultNonceSweepInterval)
+	}
+
+	existing, ok := m.entries[key]
+	if ok && !expiredAt(existing, now) {
+		return false, nil
+	}
+	if !ok && m.maxEntries > 0 && len(m.entries) >= m.maxEntries {
+		evictExpiredNonces(m.entries, now)
+		if len(m.entries) >= m.maxEntries {
+			return false, NonceStoreFullError
+		}
+	}
+	m.entries[key] = expiry
+	return true, nil
+}
+
+func (m *MemoryNonceStore) Len() int {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	evictExpiredNonces(m.entries, m.now())
+	return len(m.entries)
+}
+
+var _ NonceStore = &FileNonceStore{}
+
+// FileNonceStore persists keys in an append-only file of "<expiry> <key>" lines,
+// so single use is still enforced after a restart.
+type FileNonceStore struct {
+	lk      sync.Mutex
+	path    string
+	file    *os.File
+	entries map[string]time.Time
+	now     func() time.Time
+}
+
+func OpenFileNonceStore(path string) (*FileNonceStore, error) {
+	fs := &FileNonceStore{
+		path:    path,
+		entries: make(map[string]time.Time),
+		now:     time.Now,
+	}
+	err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	fs.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileNonceStore) load() error {
+	f, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := fs.now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			// a torn last line from an interrupted write
+			continue
+		}
+		expiryUnix, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		var expiry time.Time
+		if expiryUnix != 0 {
+			expiry = time.Unix(expiryUnix, 0)
+		}
+		if !expiredAt(expiry, now) {
+			fs.entries[parts[1]] = expiry
+		}
+	}
+	return scanner.Err()
+}
+
+func (fs *FileNonceStore) Remember(key string, expiry time.Time) (bool, error) {
+	if key == "" || strings.ContainsAny(key, " \r\n") {
+		return false, fmt.Errorf("invalid nonce key: %q", key)
+	}
+
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+
+	if existing, ok := fs.entries[key]; ok && !expiredAt(existing, fs.now()) {
+		return false, nil
+	}
+	if fs.file == nil {
+		return false, NonceStoreStateError
+	}
+
+	var expiryUnix int64
+	if !expiry.IsZero() {
+		expiryUnix = expiry.Unix()
+	}
+	_, err := fmt.Fprintf(fs.file, "%d %s\n", expiryUnix, key)
+	if err != nil {
+		return false, err
+	}
+	err = fs.file.Sync()
+	if err != nil {
+		return false, err
+	}
+	fs.entries[key] = expiry
+	return true, nil
+}
+
+// Compact rewrites the file without expired keys
+func (fs *FileNonceStore) Compact() error {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+
+	evictExpiredNonces(fs.entries, fs.now())
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for key, expiry := range fs.entries {
+		var expiryUnix int64
+		if !expiry.IsZero() {
+			expiryUnix = expiry.Unix()
+		}
+		fmt.Fprintf(w, "%d %s\n", expiryUnix, key)
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if fs.file == nil {
+		return NonceStoreStateError
+	}
+	if err = fs.file.Close(); err != nil {
+		return err
+	}
+	fs.file = nil
+	renameErr := os.Rename(tmp.Name(), fs.path)
+	// the original file is reopened when the rename fails
+	fs.file, err = os.OpenFile(fs.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		fs.file = nil
+		return fmt.Errorf("%w: %v", NonceStoreStateError, err)
+	}
+	return renameErr
+}
+
+func (fs *FileNonceStore) Close() error {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	if fs.file == nil {
+		return nil
+	}
+	err := fs.file.Close()
+	fs.file = nil
+	return err
+}
+
+func expiredAt(expiry time.Time, now time.Time) bool {
+	return !expiry.IsZero() && expiry.Before(now)
+}
+
+func evictExpiredNonces(entries map[string]time.Time, now time.Time) {
+	for key, expiry := range entries {
+		if expiredAt(expiry, now) {
+			delete(entries, key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package ucan
+
+import (
+	"context"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayGuardRejectsReusedUcans(t *testing.T) {
+	store := NewMemoryStore()
+	_, delegatedUcan := buildRevocableChain(t, store)
+
+	builder := NewProofChainBuilder(store).WithReplayGuard(NewReplayGuard(NewMemoryNonceStore()))
+	_, err := builder.FromUcan(context.Background(), delegatedUcan, nil)
+	assert.NoError(t, err)
+	_, err = builder.FromUcan(context.Background(), delegatedUcan, nil)
+	assert.ErrorIs(t, err, UcanReplayedError)
+}
+
+func TestReplayGuardKeysByNonce(t *testing.T) {
+	guard := NewReplayGuard(NewMemoryNonceStore())
+	for i := 0; i < 2; i++ {
+		ucan, err := DefaultBuilder().
+			IssuedBy(fixtures.TestIdentities.AliceKey).
+			ForAudience(fixtures.TestIdentities.BobDidString).
+			WithLifetime(60).
+			WithNonce().
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, guard.Check(ucan))
+		assert.ErrorIs(t, guard.Check(ucan), UcanReplayedError)
+	}
+}
+
+func TestMemoryNonceStoreEvictsExpiredKeys(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryNonceStore()
+	store.now = func() time.Time {
+		return now
+	}
+
+	fresh, err := store.Remember("a", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = store.Remember("forever", time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = store.Remember("a", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+	assert.Equal(t, 2, store.Len())
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 1, store.Len())
+	fresh, err = store.Remember("a", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = store.Remember("forever", time.Time{})
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+}
+
+func TestMemoryNonceStoreIsBounded(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryNonceStore().WithMaxEntries(2)
+	store.now = func() time.Time {
+		return now
+	}
+
+	fresh, err := store.Remember("a", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = store.Remember("forever", time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	_, err = store.Remember("b", time.Time{})
+	assert.ErrorIs(t, err, NonceStoreFullError)
+	fresh, err = store.Remember("forever", time.Time{})
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+
+	now = now.Add(2 * time.Minute)
+	fresh, err = store.Remember("b", time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+}
+
+func TestFileNonceStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces")
+	now := time.Now()
+
+	store, err := OpenFileNonceStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := store.Remember("expiring", now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = store.Remember("lasting", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	_, err = store.Remember("invalid key", now.Add(time.Hour))
+	assert.Error(t, err)
+	assert.NoError(t, store.Close())
+
+	reopened, err := OpenFileNonceStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err = reopened.Remember("lasting", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+
+	reopened.now = func() time.Time {
+		return now.Add(time.Minute)
+	}
+	assert.NoError(t, reopened.Compact())
+	assert.Equal(t, 1, len(reopened.entries))
+	fresh, err = reopened.Remember("expiring", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	assert.NoError(t, reopened.Close())
+
+	compacted, err := OpenFileNonceStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer compacted.Close()
+	assert.Equal(t, 2, len(compacted.entries))
+}
@@ -0,0 +1,189 @@
+package ucan
+
+import (
+	"encoding/json"
+	"fmt"
+	didkey "github.com/KenCloud-Tech/go-ucan-kc/key"
+	"github.com/ipfs/go-cid"
+	"sync"
+)
+
+const revocationChallengePrefix = "REVOKE:"
+
+var InvalidRevocationError = fmt.Errorf("invalid revocation")
+
+// Revocation is a signed record withdrawing the delegation of a ucan before it
+// expires, it is only effective when signed by the issuer of the revoked ucan or
+// by the issuer of one of its ancestors.
+//
+//	{"iss": "did:key:...", "revoke": "<cid>", "challenge": sign("REVOKE:<cid>")}
+type Revocation struct {
+	Iss       string `json:"iss"`
+	Revoke    string `json:"revoke"`
+	Challenge string `json:"challenge"`
+}
+
+func NewRevocation(issuer didkey.KeyMaterial, c cid.Cid) (*Revocation, error) {
+	iss, err := issuer.DidString()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := issuer.Sign(revocationChallengePrefix + c.String())
+	if err != nil {
+		return nil, err
+	}
+	return &Revocation{
+		Iss:       iss,
+		Revoke:    c.String(),
+		Challenge: challenge,
+	}, nil
+}
+
+func DecodeRevocation(data []byte) (*Revocation, error) {
+	rev := &Revocation{}
+	err := json.Unmarshal(data, rev)
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func (r *Revocation) Encode() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *Revocation) RevokedCid() (cid.Cid, error) {
+	return cid.Decode(r.Revoke)
+}
+
+// VerifySignature checks the challenge was signed by the issuer of the revocation
+func (r *Revocation) VerifySignature() error {
+	keyMaterial, err := didkey.ParseDidStringAndGetVertifyKey(r.Iss)
+	if err != nil {
+		return err
+	}
+	err = keyMaterial.Verify(revocationChallengePrefix+r.Revoke, r.Challenge)
+	if err != nil {
+		return fmt.Errorf("%w: %v", InvalidRevocationError, err)
+	}
+	return nil
+}
+
+// Validate checks the signature of the revocation and that its issuer is the
+// issuer of the revoked ucan or of one of its ancestors found in the store.
+func (r *Revocation) Validate(store UcanStore) error {
+	err := r.VerifySignature()
+	if err != nil {
+		return err
+	}
+	c, err := r.RevokedCid()
+	if err != nil {
+		return err
+	}
+
+	visited := make(map[cid.Cid]bool)
+	pending := []cid.Cid{c}
+	for len(pending) > 0 {
+		c, pending = pending[0], pending[1:]
+		if visited[c] {
+			continue
+		}
+		visited[c] = true
+
+		uc, err := store.ReadUcan(c)
+		if err != nil {
+			return err
+		}
+		if uc.Issuer() == r.Iss {
+			return nil
+		}
+		for _, prf := range uc.Proofs() {
+			prfCid, err := cid.Decode(prf)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, prfCid)
+		}
+	}
+	return fmt.Errorf("%w: %s is not an issuer in the chain of %s", InvalidRevocationError, r.Iss, r.Revoke)
+}
+
+// RevocationChecker decides whether a ucan of a chain has been revoked, issuers
+// holds the issuer of the ucan and of all its ancestors.
+type RevocationChecker interface {
+	IsRevoked(c cid.Cid, issuers map[string]bool) (bool, error)
+}
+
+type RevocationStore interface {
+	WriteRevocation(rev *Revocation) error
+	// ReadRevocations returns all revocations of c, or none if c is not revoked
+	ReadRevocations(c cid.Cid) ([]*Revocation, error)
+}
+
+var _ RevocationStore = &MemoryRevocationStore{}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revocations: make(map[cid.Cid][]*Revocation),
+	}
+}
+
+type MemoryRevocationStore struct {
+	lk          sync.RWMutex
+	revocations map[cid.Cid][]*Revocation
+}
+
+// WriteRevocation stores a revocation with a valid signature, whether its issuer
+// may revoke the ucan is only known once the chain is validated.
+func (m *MemoryRevocationStore) WriteRevocation(rev *Revocation) error {
+	err := rev.VerifySignature()
+	if err != nil {
+		return err
+	}
+	c, err := rev.RevokedCid()
+	if err != nil {
+		return err
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for _, existing := range m.revocations[c] {
+		if existing.Iss == rev.Iss {
+			return nil
+		}
+	}
+	m.revocations[c] = append(m.revocations[c], rev)
+	return nil
+}
+
+func (m *MemoryRevocationStore) ReadRevocations(c cid.Cid) ([]*Revocation, error) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	return append([]*Revocation(nil), m.revocations[c]...), nil
+}
+
+// NewRevocationStoreChecker checks revocations records from a RevocationStore
+func NewRevocationStoreChecker(store RevocationStore) RevocationChecker {
+	return &revocationStoreChecker{store}
+}
+
+type revocationStoreChecker struct {
+	store RevocationStore
+}
+
+func (rc *revocationStoreChecker) IsRevoked(c cid.Cid, issuers map[string]bool) (bool, error) {
+	revocations, err := rc.store.ReadRevocations(c)
+	if err != nil {
+		return false, err
+	}
+	for _, revocation := range revocations {
+		if !issuers[revocation.Iss] || revocation.Revoke != c.String() {
+			continue
+		}
+		if revocation.VerifySignature() != nil {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,373 @@
+package ucan
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	didkey "github.com/KenCloud-Tech/go-ucan-kc/key"
+	"github.com/ipfs/go-cid"
+	mb "github.com/multiformats/go-multibase"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RevocationListEncoding string
+
+const (
+	// SortedRevocationList carries the exact sorted list of revoked cids
+	SortedRevocationList RevocationListEncoding = "sorted"
+	// BloomRevocationList only carries a Bloom filter of the revoked cids, hits
+	// are confirmed by the exact fallback of the verifier
+	BloomRevocationList RevocationListEncoding = "bloom"
+
+	revocationListType = "RVL"
+	// bloomFalsePositiveRate is the false positive rate Bloom filters are sized for
+	bloomFalsePositiveRate = 0.001
+	maxBloomHashes         = 64
+)
+
+var (
+	StaleRevocationListError    = fmt.Errorf("stale revocation list")
+	OutdatedRevocationListError = fmt.Errorf("outdated revocation list sequence")
+)
+
+type RevocationListPayload struct {
+	Iss      string                 `json:"iss"`
+	Seq      uint64                 `json:"seq"`
+	Iat      int64                  `json:"iat"`
+	Encoding RevocationListEncoding `json:"enc"`
+	Revoked  []string               `json:"revoked,omitempty"`
+	Bloom    *BloomFilter           `json:"bloom,omitempty"`
+}
+
+// RevocationList is a signed and versioned snapshot of all cids revoked by an
+// issuer, published for verifiers which can not query revocations online.
+type RevocationList struct {
+	Header     UcanHeader
+	Payload    RevocationListPayload
+	DataToSign []byte
+	Signature  []byte
+}
+
+func BuildRevocationList(issuer didkey.KeyMaterial, seq uint64, issuedAt time.Time, revoked []cid.Cid, encoding RevocationListEncoding) (*RevocationList, error) {
+	iss, err := issuer.DidString()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := RevocationListPayload{
+		Iss:      iss,
+		Seq:      seq,
+		Iat:      issuedAt.Unix(),
+		Encoding: encoding,
+	}
+	switch encoding {
+	case SortedRevocationList:
+		payload.Revoked = make([]string, 0, len(revoked))
+		for _, c := range revoked {
+			payload.Revoked = append(payload.Revoked, c.String())
+		}
+		sort.Strings(payload.Revoked)
+	case BloomRevocationList:
+		payload.Bloom = NewBloomFilter(len(revoked), bloomFalsePositiveRate)
+		for _, c := range revoked {
+			payload.Bloom.Add(c)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported revocation list encoding: %s", encoding)
+	}
+
+	rl := &RevocationList{
+		Header: UcanHeader{
+			Algorithm: issuer.GetJwtAlgorithmName(),
+			Type:      revocationListType,
+		},
+		Payload: payload,
+	}
+
+	headerBase64, err := rl.Header.Encode()
+	if err != nil {
+		return nil, err
+	}
+	payloadBytes, err := json.Marshal(rl.Payload)
+	if err != nil {
+		return nil, err
+	}
+	payloadBase64, err := mb.Encode(mb.Base64url, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	dataToSign := headerBase64 + "." + payloadBase64
+	signature, err := issuer.Sign(dataToSign)
+	if err != nil {
+		return nil, err
+	}
+	rl.DataToSign = []byte(dataToSign)
+	rl.Signature = []byte(signature)
+	return rl, nil
+}
+
+func (rl *RevocationList) Encode() (string, error) {
+	signature, err := mb.Encode(mb.Base64url, rl.Signature)
+	if err != nil {
+		return "", err
+	}
+	return string(rl.DataToSign) + "." + signature, nil
+}
+
+func DecodeRevocationList(str string) (*RevocationList, error) {
+	parts := strings.Split(str, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid revocation list format")
+	}
+
+	partsBytes := make([][]byte, 3)
+	for i := range parts {
+		encoding, data, err := mb.Decode(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", EncodingError, err)
+		}
+		if encoding != mb.Base64url {
+			return nil, EncodingError
+		}
+		partsBytes[i] = data
+	}
+
+	rl := &RevocationList{
+		DataToSign: []byte(parts[0] + "." + parts[1]),
+		Signature:  partsBytes[2],
+	}
+	err := json.Unmarshal(partsBytes[0], &rl.Header)
+	if err != nil {
+		return nil, err
+	}
+	if rl.Header.Type != revocationListType {
+		return nil, fmt.Errorf("unexpected revocation list type: %s", rl.Header.Type)
+	}
+	err = json.Unmarshal(partsBytes[1], &rl.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+func (rl *RevocationList) Issuer() string {
+	return rl.Payload.Iss
+}
+
+func (rl *RevocationList) IssuedAt() time.Time {
+	return time.Unix(rl.Payload.Iat, 0)
+}
+
+func (rl *RevocationList) VerifySignature() error {
+	keyMaterial, err := didkey.ParseDidStringAndGetVertifyKey(rl.Payload.Iss)
+	if err != nil {
+		return err
+	}
+	err = keyMaterial.Verify(string(rl.DataToSign), string(rl.Signature))
+	if err != nil {
+		return fmt.Errorf("%w: %v", InvalidRevocationError, err)
+	}
+	return nil
+}
+
+// validate checks the payload can be queried as announced by its encoding
+func (rl *RevocationList) validate() error {
+	switch rl.Payload.Encoding {
+	case SortedRevocationList:
+		if !sort.StringsAreSorted(rl.Payload.Revoked) {
+			return fmt.Errorf("%w: revoked cids are not sorted", InvalidRevocationError)
+		}
+	case BloomRevocationList:
+		bf := rl.Payload.Bloom
+		if bf == nil || bf.M == 0 || bf.K == 0 || bf.K > maxBloomHashes || uint64(len(bf.Bits))*8 < bf.M {
+			return fmt.Errorf("%w: malformed bloom filter", InvalidRevocationError)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported encoding %s", InvalidRevocationError, rl.Payload.Encoding)
+	}
+	return nil
+}
+
+// Contains reports whether c is revoked by the list, exact tells whether the
+// answer is definite or a Bloom filter hit which may be a false positive.
+func (rl *RevocationList) Contains(c cid.Cid) (contains bool, exact bool) {
+	switch rl.Payload.Encoding {
+	case SortedRevocationList:
+		str := c.String()
+		idx := sort.SearchStrings(rl.Payload.Revoked, str)
+		return idx < len(rl.Payload.Revoked) && rl.Payload.Revoked[idx] == str, true
+	case BloomRevocationList:
+		if rl.Payload.Bloom == nil {
+			return false, true
+		}
+		if rl.Payload.Bloom.MayContain(c) {
+			return true, false
+		}
+		return false, true
+	default:
+		return false, true
+	}
+}
+
+// RevocationListPolicy decides which snapshots a verifier accepts
+type RevocationListPolicy struct {
+	// MaxAge rejects snapshots issued longer ago, zero accepts snapshots of any age
+	MaxAge time.Duration
+}
+
+var _ RevocationChecker = &RevocationListChecker{}
+
+// RevocationListChecker checks chains against the latest revocation list
+// snapshot loaded for each issuer.
+type RevocationListChecker struct {
+	lk       sync.RWMutex
+	policy   RevocationListPolicy
+	lists    map[string]*RevocationList
+	fallback RevocationChecker
+	now      func() time.Time
+}
+
+func NewRevocationListChecker(policy RevocationListPolicy) *RevocationListChecker {
+	return &RevocationListChecker{
+		policy: policy,
+		lists:  make(map[string]*RevocationList),
+		now:    time.Now,
+	}
+}
+
+// WithFallback sets the exact checker confirming Bloom filter hits, without a
+// fallback every hit is considered revoked.
+func (rc *RevocationListChecker) WithFallback(fallback RevocationChecker) *RevocationListChecker {
+	rc.fallback = fallback
+	return rc
+}
+
+// Load verifies a snapshot and makes it the current snapshot of its issuer,
+// stale snapshots and snapshots not newer than the current one are rejected.
+func (rc *RevocationListChecker) Load(rl *RevocationList) error {
+	err := rl.VerifySignature()
+	if err != nil {
+		return err
+	}
+	err = rl.validate()
+	if err != nil {
+		return err
+	}
+	if rc.isStale(rl) {
+		return fmt.Errorf("%w: %s issued at %s", StaleRevocationListError, rl.Issuer(), rl.IssuedAt())
+	}
+
+	rc.lk.Lock()
+	defer rc.lk.Unlock()
+	if current, ok := rc.lists[rl.Issuer()]; ok && current.Payload.Seq >= rl.Payload.Seq {
+		return fmt.Errorf("%w: %d is not newer than %d", OutdatedRevocationListError, rl.Payload.Seq, current.Payload.Seq)
+	}
+	rc.lists[rl.Issuer()] = rl
+	return nil
+}
+
+func (rc *RevocationListChecker) LoadString(str string) error {
+	rl, err := DecodeRevocationList(str)
+	if err != nil {
+		return err
+	}
+	return rc.Load(rl)
+}
+
+func (rc *RevocationListChecker) isStale(rl *RevocationList) bool {
+	if rc.policy.MaxAge <= 0 {
+		return false
+	}
+	return rc.now().Sub(rl.IssuedAt()) > rc.policy.MaxAge
+}
+
+// IsRevoked fails when the snapshot of an issuer of the chain became stale, so
+// verifiers never silently rely on outdated revocation state.
+func (rc *RevocationListChecker) IsRevoked(c cid.Cid, issuers map[string]bool) (bool, error) {
+	rc.lk.RLock()
+	lists := make([]*RevocationList, 0)
+	for issuer := range issuers {
+		if rl, ok := rc.lists[issuer]; ok {
+			lists = append(lists, rl)
+		}
+	}
+	rc.lk.RUnlock()
+
+	for _, rl := range lists {
+		if rc.isStale(rl) {
+			return false, fmt.Errorf("%w: %s issued at %s", StaleRevocationListError, rl.Issuer(), rl.IssuedAt())
+		}
+		contains, exact := rl.Contains(c)
+		if !contains {
+			continue
+		}
+		if exact || rc.fallback == nil {
+			return true, nil
+		}
+		revoked, err := rc.fallback.IsRevoked(c, issuers)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	return false, nil
+}
+
+// BloomFilter is a compact probabilistic set of cids, it never reports false negatives
+type BloomFilter struct {
+	M    uint64 `json:"m"`
+	K    uint64 `json:"k"`
+	Bits []byte `json:"bits"`
+}
+
+// NewBloomFilter sizes a filter for n entries with the false positive rate p
+func NewBloomFilter(n int, p float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		M:    m,
+		K:    k,
+		Bits: make([]byte, (m+7)/8),
+	}
+}
+
+func (bf *BloomFilter) Add(c cid.Cid) {
+	for _, idx := range bf.indexes(c) {
+		bf.Bits[idx/8] |= 1 << (idx % 8)
+	}
+}
+
+func (bf *BloomFilter) MayContain(c cid.Cid) bool {
+	if bf.M == 0 || uint64(len(bf.Bits))*8 < bf.M {
+		return true
+	}
+	for _, idx := range bf.indexes(c) {
+		if bf.Bits[idx/8]&(1<<(idx%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// indexes derives the K bit positions of c by double hashing
+func (bf *BloomFilter) indexes(c cid.Cid) []uint64 {
+	sum := sha256.Sum256(c.Bytes())
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16])
+	indexes := make([]uint64, bf.K)
+	for i := uint64(0); i < bf.K; i++ {
+		indexes[i] = (h1 + i*h2) % bf.M
+	}
+	return indexes
+}
@@ -0,0 +1,199 @@
+package ucan
+
+import (
+	"context"
+	"fmt"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func buildRevocableChain(t *testing.T, store UcanStore) (cid.Cid, *Ucan) {
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegatedUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(leafUcan, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCid, err := store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leafCid, delegatedUcan
+}
+
+func TestRevocationListRoundTrip(t *testing.T) {
+	store := NewMemoryStore()
+	leafCid, _ := buildRevocableChain(t, store)
+
+	for _, encoding := range []RevocationListEncoding{SortedRevocationList, BloomRevocationList} {
+		rl, err := BuildRevocationList(fixtures.TestIdentities.AliceKey, 1, time.Now(), []cid.Cid{leafCid}, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rlStr, err := rl.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reRl, err := DecodeRevocationList(rlStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, reRl.VerifySignature())
+		assert.Equal(t, rl.Payload, reRl.Payload)
+
+		contains, _ := reRl.Contains(leafCid)
+		assert.True(t, contains)
+	}
+}
+
+func TestRevocationListRejectsChains(t *testing.T) {
+	store := NewMemoryStore()
+	leafCid, delegatedUcan := buildRevocableChain(t, store)
+
+	checker := NewRevocationListChecker(RevocationListPolicy{MaxAge: time.Hour})
+	builder := NewProofChainBuilder(store).WithRevocationChecker(checker)
+
+	empty, err := BuildRevocationList(fixtures.TestIdentities.AliceKey, 1, time.Now(), nil, SortedRevocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, checker.Load(empty))
+	_, err = builder.FromUcan(context.Background(), delegatedUcan, nil)
+	assert.NoError(t, err)
+
+	rl, err := BuildRevocationList(fixtures.TestIdentities.AliceKey, 2, time.Now(), []cid.Cid{leafCid}, SortedRevocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rlStr, err := rl.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, checker.LoadString(rlStr))
+	_, err = builder.FromUcan(context.Background(), delegatedUcan, nil)
+	assert.ErrorIs(t, err, UcanRevokedError)
+
+	// older snapshots can not roll the revocation back
+	assert.ErrorIs(t, checker.Load(empty), OutdatedRevocationListError)
+}
+
+func TestRevocationListIgnoresUnrelatedIssuers(t *testing.T) {
+	store := NewMemoryStore()
+	leafCid, delegatedUcan := buildRevocableChain(t, store)
+
+	rl, err := BuildRevocationList(fixtures.TestIdentities.MalloryKey, 1, time.Now(), []cid.Cid{leafCid}, SortedRevocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := NewRevocationListChecker(RevocationListPolicy{})
+	assert.NoError(t, checker.Load(rl))
+
+	_, err = NewProofChainBuilder(store).WithRevocationChecker(checker).FromUcan(context.Background(), delegatedUcan, nil)
+	assert.NoError(t, err)
+}
+
+func TestBloomRevocationListFallback(t *testing.T) {
+	store := NewMemoryStore()
+	leafCid, delegatedUcan := buildRevocableChain(t, store)
+
+	rl, err := BuildRevocationList(fixtures.TestIdentities.AliceKey, 1, time.Now(), []cid.Cid{leafCid}, BloomRevocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the exact fallback does not know about the revocation, so the hit is a false positive
+	revocations := NewMemoryRevocationStore()
+	checker := NewRevocationListChecker(RevocationListPolicy{}).WithFallback(NewRevocationStoreChecker(revocations))
+	assert.NoError(t, checker.Load(rl))
+	builder := NewProofChainBuilder(store).WithRevocationChecker(checker)
+	_, err = builder.FromUcan(context.Background(), delegatedUcan, nil)
+	assert.NoError(t, err)
+
+	revocation, err := NewRevocation(fixtures.TestIdentities.AliceKey, leafCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, revocations.WriteRevocation(revocation))
+	_, err = builder.FromUcan(context.Background(), delegatedUcan, nil)
+	assert.ErrorIs(t, err, UcanRevokedError)
+
+	// without a fallback every hit counts as revoked
+	strict := NewRevocationListChecker(RevocationListPolicy{})
+	assert.NoError(t, strict.Load(rl))
+	_, err = NewProofChainBuilder(store).WithRevocationChecker(strict).FromUcan(context.Background(), delegatedUcan, nil)
+	assert.ErrorIs(t, err, UcanRevokedError)
+}
+
+func TestBloomFilterHasNoFalseNegatives(t *testing.T) {
+	cids := make([]cid.Cid, 0)
+	for i := 0; i < 500; i++ {
+		c, err := DefaultPrefix.Sum([]byte(fmt.Sprintf("ucan-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, c)
+	}
+
+	bf := NewBloomFilter(250, bloomFalsePositiveRate)
+	for _, c := range cids[:250] {
+		bf.Add(c)
+	}
+	falsePositives := 0
+	for _, c := range cids[:250] {
+		assert.True(t, bf.MayContain(c))
+	}
+	for _, c := range cids[250:] {
+		if bf.MayContain(c) {
+			falsePositives++
+		}
+	}
+	assert.True(t, falsePositives < 5, "%d false positives", falsePositives)
+}
+
+func TestRejectsStaleRevocationLists(t *testing.T) {
+	store := NewMemoryStore()
+	_, delegatedUcan := buildRevocableChain(t, store)
+
+	old, err := BuildRevocationList(fixtures.TestIdentities.AliceKey, 1, time.Now().Add(-2*time.Hour), nil, SortedRevocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := NewRevocationListChecker(RevocationListPolicy{MaxAge: time.Hour})
+	assert.ErrorIs(t, checker.Load(old), StaleRevocationListError)
+
+	fresh, err := BuildRevocationList(fixtures.TestIdentities.AliceKey, 2, time.Now(), nil, SortedRevocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, checker.Load(fresh))
+
+	// the snapshot goes stale once it is older than the policy allows
+	checker.now = func() time.Time {
+		return time.Now().Add(2 * time.Hour)
+	}
+	_, err = NewProofChainBuilder(store).WithRevocationChecker(checker).FromUcan(context.Background(), delegatedUcan, nil)
+	assert.ErrorIs(t, err, StaleRevocationListError)
+}
+
+func TestRejectsTamperedRevocationLists(t *testing.T) {
+	rl, err := BuildRevocationList(fixtures.TestIdentities.AliceKey, 1, time.Now(), nil, SortedRevocationList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl.Payload.Iss = fixtures.TestIdentities.BobDidString
+	assert.ErrorIs(t, NewRevocationListChecker(RevocationListPolicy{}).Load(rl), InvalidRevocationError)
+}
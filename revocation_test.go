@@ -0,0 +1,194 @@
+package ucan
+
+import (
+	"context"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRevocationRejectsDescendants(t *testing.T) {
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegatedUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(leafUcan, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	leafCid, err := store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegatedCid, err := store.WriteUcan(delegatedUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocations := NewMemoryRevocationStore()
+	builder := NewProofChainBuilder(store).WithRevocationStore(revocations)
+
+	// revocations from outside of the chain are ignored
+	malloryRevocation, err := NewRevocation(fixtures.TestIdentities.MalloryKey, leafCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, revocations.WriteRevocation(malloryRevocation))
+	assert.ErrorIs(t, malloryRevocation.Validate(store), InvalidRevocationError)
+	_, err = builder.FromUcanCid(context.Background(), delegatedCid, nil)
+	assert.NoError(t, err)
+
+	aliceRevocation, err := NewRevocation(fixtures.TestIdentities.AliceKey, leafCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, aliceRevocation.Validate(store))
+	assert.NoError(t, revocations.WriteRevocation(aliceRevocation))
+
+	_, err = builder.FromUcanCid(context.Background(), leafCid, nil)
+	assert.ErrorIs(t, err, UcanRevokedError)
+	_, err = builder.FromUcan(context.Background(), delegatedUcan, nil)
+	assert.ErrorIs(t, err, UcanRevokedError)
+
+	// without a revocation store the chain is still valid
+	_, err = ProofChainFromUcan(delegatedUcan, nil, store)
+	assert.NoError(t, err)
+}
+
+func TestRevocationByAncestorIssuer(t *testing.T) {
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegatedUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(leafUcan, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	_, err = store.WriteUcan(leafUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegatedCid, err := store.WriteUcan(delegatedUcan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocation, err := NewRevocation(fixtures.TestIdentities.AliceKey, delegatedCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, revocation.Validate(store))
+
+	revocations := NewMemoryRevocationStore()
+	assert.NoError(t, revocations.WriteRevocation(revocation))
+
+	_, err = NewProofChainBuilder(store).
+		WithRevocationStore(revocations).
+		FromUcan(context.Background(), delegatedUcan, nil)
+	assert.ErrorIs(t, err, UcanRevokedError)
+}
+
+func TestRevocationRoundTrip(t *testing.T) {
+	ucan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := ucan.ToCid(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocation, err := NewRevocation(fixtures.TestIdentities.AliceKey, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocationBytes, err := revocation.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reRevocation, err := DecodeRevocation(revocationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, revocation, reRevocation)
+	assert.NoError(t, reRevocation.VerifySignature())
+
+	// the challenge only verifies against its own issuer
+	reRevocation.Iss = fixtures.TestIdentities.BobDidString
+	assert.ErrorIs(t, reRevocation.VerifySignature(), InvalidRevocationError)
+	assert.Error(t, NewMemoryRevocationStore().WriteRevocation(reRevocation))
+}
+
+func TestRevocationOfAnyPrefix(t *testing.T) {
+	sha256Prefix := &cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	leafUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(60).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegatedUcan, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(leafUcan, sha256Prefix).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	sha256Cid, err := store.WriteUcan(leafUcan, sha256Prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonicalCid, _, err := leafUcan.ToCid(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []cid.Cid{sha256Cid, canonicalCid} {
+		revocation, err := NewRevocation(fixtures.TestIdentities.AliceKey, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revocations := NewMemoryRevocationStore()
+		assert.NoError(t, revocations.WriteRevocation(revocation))
+		builder := NewProofChainBuilder(store).WithRevocationStore(revocations)
+
+		_, err = builder.FromUcan(context.Background(), delegatedUcan, nil)
+		assert.ErrorIs(t, err, UcanRevokedError)
+		_, err = builder.FromUcanCid(context.Background(), sha256Cid, nil)
+		assert.ErrorIs(t, err, UcanRevokedError)
+	}
+}
@@ -1,9 +1,13 @@
 package ucan
 
 import (
+	"container/list"
+	"context"
 	"fmt"
 	"github.com/ipfs/go-cid"
 	mh "github.com/multiformats/go-multihash"
+	"sync"
+	"time"
 )
 
 var DefaultPrefix = cid.Prefix{
@@ -13,6 +17,17 @@ var DefaultPrefix = cid.Prefix{
 	MhLength: -1, // default length
 }
 
+const (
+	defaultStoreSweepInterval = time.Minute
+	// DefaultStoreExpiryMargin is how long a MemoryStore keeps ucans past their
+	// exp, so chains validated at earlier times or under clock skew still resolve
+	DefaultStoreExpiryMargin = 10 * time.Minute
+)
+
+var UcanNotFoundError = fmt.Errorf("ucan not found")
+
+// UcanStore keeps encoded ucans by cid. Proof chains verify every ucan read
+// against its cid, wrap a store with NewVerifyingStore to verify other reads.
 type UcanStore interface {
 	ReadUcan(c cid.Cid) (*Ucan, error)
 	WriteUcan(uc *Ucan, prefix *cid.Prefix) (cid.Cid, error)
@@ -20,45 +35,151 @@ type UcanStore interface {
 	WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error)
 }
 
+// ContextUcanStore is a UcanStore whose operations honour cancellation and
+// deadlines, typically because they are backed by the network.
+type ContextUcanStore interface {
+	ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error)
+	WriteUcanContext(ctx context.Context, uc *Ucan, prefix *cid.Prefix) (cid.Cid, error)
+	ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error)
+	WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error)
+}
+
+// NewContextStore adapts a UcanStore to ContextUcanStore. Stores that already
+// implement ContextUcanStore are returned unchanged, others only check the
+// context before each operation.
+func NewContextStore(store UcanStore) ContextUcanStore {
+	if cs, ok := store.(ContextUcanStore); ok {
+		return cs
+	}
+	return &contextStore{store}
+}
+
+type contextStore struct {
+	store UcanStore
+}
+
+func (cs *contextStore) ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cs.store.ReadUcan(c)
+}
+
+func (cs *contextStore) WriteUcanContext(ctx context.Context, uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	if err := ctx.Err(); err != nil {
+		return cid.Undef, err
+	}
+	return cs.store.WriteUcan(uc, prefix)
+}
+
+func (cs *contextStore) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return cs.store.ReadUcanStr(c)
+}
+
+func (cs *contextStore) WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error) {
+	if err := ctx.Err(); err != nil {
+		return cid.Undef, err
+	}
+	return cs.store.WriteUcanStr(str, prefix)
+}
+
 var _ UcanStore = &MemoryStore{}
+var _ ContextUcanStore = &MemoryStore{}
+
+// MemoryStore keeps ucans in memory, it is safe for concurrent use. Ucans
+// expired for longer than the expiry margin are dropped: reads and Has treat
+// them as missing, List and Len sweep them and writes sweep them periodically.
+// Ucans within the margin are returned and their expiry left to the validator.
+// When a size bound is set, the least recently used ucans are evicted to make
+// room for new ones.
+type MemoryStore struct {
+	lk           sync.Mutex
+	entries      map[cid.Cid]*list.Element
+	recency      *list.List
+	maxEntries   int
+	expiryMargin time.Duration
+	nextSweep    time.Time
+	now          func() time.Time
+}
+
+type memoryEntry struct {
+	c      cid.Cid
+	str    string
+	expiry time.Time
+}
 
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		make(map[cid.Cid]string),
+		entries:      make(map[cid.Cid]*list.Element),
+		recency:      list.New(),
+		expiryMargin: DefaultStoreExpiryMargin,
+		now:          time.Now,
 	}
 }
 
-type MemoryStore struct {
-	store map[cid.Cid]string
+// WithMaxEntries bounds the number of ucans kept, zero means unbounded
+func (m *MemoryStore) WithMaxEntries(maxEntries int) *MemoryStore {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.maxEntries = maxEntries
+	m.evictOverflow()
+	return m
 }
 
-func (m MemoryStore) ReadUcan(c cid.Cid) (*Ucan, error) {
-	if str, ok := m.store[c]; !ok {
-		return nil, fmt.Errorf("ucan for cid:%s not exist", c.String())
-	} else {
-		return DecodeUcanString(str)
+// WithExpiryMargin sets how long ucans are kept past their exp
+func (m *MemoryStore) WithExpiryMargin(margin time.Duration) *MemoryStore {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.expiryMargin = margin
+	return m
+}
+
+func (m *MemoryStore) ReadUcan(c cid.Cid) (*Ucan, error) {
+	str, err := m.ReadUcanStr(c)
+	if err != nil {
+		return nil, err
 	}
+	return DecodeUcanString(str)
 }
 
-func (m MemoryStore) WriteUcan(uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+func (m *MemoryStore) WriteUcan(uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
 	c, str, err := uc.ToCid(prefix)
 	if err != nil {
 		return cid.Undef, err
 	}
-	m.store[c] = str
-	return c, err
+	m.put(c, str, uc.Expires())
+	return c, nil
+}
+
+func (m *MemoryStore) ReadUcanStr(c cid.Cid) (string, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	elem, ok := m.lookup(c)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", UcanNotFoundError, c.String())
+	}
+	m.recency.MoveToFront(elem)
+	return elem.Value.(*memoryEntry).str, nil
 }
 
-func (m MemoryStore) ReadUcanStr(c cid.Cid) (string, error) {
-	if str, ok := m.store[c]; !ok {
-		return "", fmt.Errorf("ucan for cid:%s not exist", c.String())
-	} else {
-		return str, nil
+// PeekUcanStr reads the ucan of c without marking it as recently used
+func (m *MemoryStore) PeekUcanStr(c cid.Cid) (string, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	elem, ok := m.lookup(c)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", UcanNotFoundError, c.String())
 	}
+	return elem.Value.(*memoryEntry).str, nil
 }
 
-func (m MemoryStore) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
-	_, err := DecodeUcanString(str)
+func (m *MemoryStore) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
+	uc, err := DecodeUcanString(str)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -69,6 +190,135 @@ func (m MemoryStore) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, erro
 	if err != nil {
 		return cid.Undef, err
 	}
-	m.store[c] = str
+	m.put(c, str, uc.Expires())
 	return c, nil
 }
+
+// Has reports whether a ucan is stored under c
+func (m *MemoryStore) Has(c cid.Cid) bool {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	_, ok := m.lookup(c)
+	return ok
+}
+
+// Delete removes the ucan stored under c, deleting a missing ucan is not an error
+func (m *MemoryStore) Delete(c cid.Cid) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if elem, ok := m.entries[c]; ok {
+		m.remove(elem)
+	}
+	return nil
+}
+
+// List returns the cids of the stored ucans, most recently used first
+func (m *MemoryStore) List() ([]cid.Cid, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.evictExpired(m.now())
+	cids := make([]cid.Cid, 0, m.recency.Len())
+	for elem := m.recency.Front(); elem != nil; elem = elem.Next() {
+		cids = append(cids, elem.Value.(*memoryEntry).c)
+	}
+	return cids, nil
+}
+
+// Len returns the number of stored ucans, expired ucans are swept first
+func (m *MemoryStore) Len() int {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	m.evictExpired(m.now())
+	return m.recency.Len()
+}
+
+func (m *MemoryStore) put(c cid.Cid, str string, exp *int64) {
+	var expiry time.Time
+	if exp != nil {
+		expiry = time.Unix(*exp, 0)
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	now := m.now()
+	if now.After(m.nextSweep) {
+		m.evictExpired(now)
+		m.nextSweep = now.Add(defaultStoreSweepInterval)
+	}
+
+	if elem, ok := m.entries[c]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.str = str
+		entry.expiry = expiry
+		m.recency.MoveToFront(elem)
+		return
+	}
+	m.entries[c] = m.recency.PushFront(&memoryEntry{c: c, str: str, expiry: expiry})
+	m.evictOverflow()
+}
+
+// lookup returns the entry of c, dropping it when expired past the margin
+func (m *MemoryStore) lookup(c cid.Cid) (*list.Element, bool) {
+	elem, ok := m.entries[c]
+	if !ok {
+		return nil, false
+	}
+	if expiredAt(elem.Value.(*memoryEntry).expiry, m.now().Add(-m.expiryMargin)) {
+		m.remove(elem)
+		return nil, false
+	}
+	return elem, true
+}
+
+func (m *MemoryStore) remove(elem *list.Element) {
+	m.recency.Remove(elem)
+	delete(m.entries, elem.Value.(*memoryEntry).c)
+}
+
+func (m *MemoryStore) evictExpired(now time.Time) {
+	cutoff := now.Add(-m.expiryMargin)
+	for _, elem := range m.entries {
+		if expiredAt(elem.Value.(*memoryEntry).expiry, cutoff) {
+			m.remove(elem)
+		}
+	}
+}
+
+func (m *MemoryStore) evictOverflow() {
+	for m.maxEntries > 0 && m.recency.Len() > m.maxEntries {
+		m.remove(m.recency.Back())
+	}
+}
+
+func (m *MemoryStore) ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.ReadUcan(c)
+}
+
+func (m *MemoryStore) WriteUcanContext(ctx context.Context, uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	if err := ctx.Err(); err != nil {
+		return cid.Undef, err
+	}
+	return m.WriteUcan(uc, prefix)
+}
+
+func (m *MemoryStore) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return m.ReadUcanStr(c)
+}
+
+func (m *MemoryStore) WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error) {
+	if err := ctx.Err(); err != nil {
+		return cid.Undef, err
+	}
+	return m.WriteUcanStr(str, prefix)
+}
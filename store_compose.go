@@ -0,0 +1,410 @@
+package ucan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ipfs/go-cid"
+	"sync"
+)
+
+var ReadOnlyStoreError = fmt.Errorf("store is read only")
+
+// WritePolicy decides which tiers of a TieredStore receive writes
+type WritePolicy int
+
+const (
+	// WriteThrough writes to every tier before returning
+	WriteThrough WritePolicy = iota
+	// WriteBack writes to the first tier and keeps the ucan pending until Flush
+	// writes it to the other tiers
+	WriteBack
+)
+
+// deleter and lister are implemented by stores which can delete and enumerate ucans
+type deleter interface {
+	Delete(c cid.Cid) error
+}
+
+type lister interface {
+	List() ([]cid.Cid, error)
+}
+
+var _ UcanStore = &TieredStore{}
+var _ ContextUcanStore = &TieredStore{}
+
+// TieredStore stacks stores from fastest to slowest, e.g. a MemoryStore in
+// front of a persistent store in front of a remote one. Reads try the tiers in
+// order and promote hits into the faster tiers.
+type TieredStore struct {
+	tiers   []ContextUcanStore
+	policy  WritePolicy
+	promote bool
+
+	lk      sync.Mutex
+	pending map[cid.Cid]string
+}
+
+// NewTieredStore stacks tiers, the fastest first
+func NewTieredStore(tiers ...UcanStore) *TieredStore {
+	ts := &TieredStore{
+		tiers:   make([]ContextUcanStore, len(tiers)),
+		policy:  WriteThrough,
+		promote: true,
+		pending: make(map[cid.Cid]string),
+	}
+	for i, tier := range tiers {
+		ts.tiers[i] = NewContextStore(tier)
+	}
+	return ts
+}
+
+// WithWritePolicy sets the tiers receiving writes, WriteThrough by default
+func (ts *TieredStore) WithWritePolicy(policy WritePolicy) *TieredStore {
+	ts.policy = policy
+	return ts
+}
+
+// WithoutPromotion stops copying ucans found in slower tiers into faster ones
+func (ts *TieredStore) WithoutPromotion() *TieredStore {
+	ts.promote = false
+	return ts
+}
+
+func (ts *TieredStore) ReadUcan(c cid.Cid) (*Ucan, error) {
+	return ts.ReadUcanContext(context.Background(), c)
+}
+
+func (ts *TieredStore) WriteUcan(uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	return ts.WriteUcanContext(context.Background(), uc, prefix)
+}
+
+func (ts *TieredStore) ReadUcanStr(c cid.Cid) (string, error) {
+	return ts.ReadUcanStrContext(context.Background(), c)
+}
+
+func (ts *TieredStore) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
+	return ts.WriteUcanStrContext(context.Background(), str, prefix)
+}
+
+func (ts *TieredStore) ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	str, err := ts.ReadUcanStrContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeUcanString(str)
+}
+
+func (ts *TieredStore) WriteUcanContext(ctx context.Context, uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	str, err := uc.Encode()
+	if err != nil {
+		return cid.Undef, err
+	}
+	return ts.WriteUcanStrContext(ctx, str, prefix)
+}
+
+// ReadUcanStrContext returns the ucan of the first tier holding it. When no
+// tier holds it, the first error other than UcanNotFoundError is returned.
+func (ts *TieredStore) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	var firstErr error
+	for i, tier := range ts.tiers {
+		str, err := tier.ReadUcanStrContext(ctx, c)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return "", ctxErr
+			}
+			if firstErr == nil && !errors.Is(err, UcanNotFoundError) {
+				firstErr = err
+			}
+			continue
+		}
+		// promote only what matches its cid, a faulty tier must not spread
+		if ts.promote && i > 0 && VerifyUcanCid(c, str) == nil {
+			prefix := c.Prefix()
+			for _, faster := range ts.tiers[:i] {
+				_, _ = faster.WriteUcanStrContext(ctx, str, &prefix)
+			}
+		}
+		return str, nil
+	}
+
+	ts.lk.Lock()
+	str, ok := ts.pending[c]
+	ts.lk.Unlock()
+	if ok {
+		return str, nil
+	}
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return "", fmt.Errorf("%w: %s", UcanNotFoundError, c.String())
+}
+
+// WriteUcanStrContext writes to the tiers of the write policy, read only
+// tiers are skipped
+func (ts *TieredStore) WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error) {
+	tiers := ts.tiers
+	if ts.policy == WriteBack && len(tiers) > 0 {
+		tiers = tiers[:1]
+	}
+	c := cid.Undef
+	for _, tier := range tiers {
+		written, err := tier.WriteUcanStrContext(ctx, str, prefix)
+		if errors.Is(err, ReadOnlyStoreError) {
+			continue
+		}
+		if err != nil {
+			return cid.Undef, err
+		}
+		c = written
+	}
+	if !c.Defined() {
+		return cid.Undef, ReadOnlyStoreError
+	}
+
+	if ts.policy == WriteBack && len(ts.tiers) > 1 {
+		ts.lk.Lock()
+		ts.pending[c] = str
+		ts.lk.Unlock()
+	}
+	return c, nil
+}
+
+// Flush writes the ucans pending under WriteBack to the slower tiers
+func (ts *TieredStore) Flush(ctx context.Context) error {
+	ts.lk.Lock()
+	pending := make(map[cid.Cid]string, len(ts.pending))
+	for c, str := range ts.pending {
+		pending[c] = str
+	}
+	ts.lk.Unlock()
+
+	for c, str := range pending {
+		prefix := c.Prefix()
+		for _, tier := range ts.tiers[1:] {
+			_, err := tier.WriteUcanStrContext(ctx, str, &prefix)
+			if err != nil && !errors.Is(err, ReadOnlyStoreError) {
+				return err
+			}
+		}
+		ts.lk.Lock()
+		delete(ts.pending, c)
+		ts.lk.Unlock()
+	}
+	return nil
+}
+
+// Delete removes c from every tier which can delete ucans
+func (ts *TieredStore) Delete(c cid.Cid) error {
+	ts.lk.Lock()
+	delete(ts.pending, c)
+	ts.lk.Unlock()
+
+	for _, tier := range ts.tiers {
+		if d, ok := unwrapContextStore(tier).(deleter); ok {
+			err := d.Delete(c)
+			if err != nil && !errors.Is(err, ReadOnlyStoreError) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the cids of the ucans of every tier which can enumerate them
+func (ts *TieredStore) List() ([]cid.Cid, error) {
+	seen := make(map[cid.Cid]bool)
+	cids := make([]cid.Cid, 0)
+	add := func(c cid.Cid) {
+		if !seen[c] {
+			seen[c] = true
+			cids = append(cids, c)
+		}
+	}
+	for _, tier := range ts.tiers {
+		if l, ok := unwrapContextStore(tier).(lister); ok {
+			tierCids, err := l.List()
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range tierCids {
+				add(c)
+			}
+		}
+	}
+	ts.lk.Lock()
+	defer ts.lk.Unlock()
+	for c := range ts.pending {
+		add(c)
+	}
+	return cids, nil
+}
+
+// unwrapContextStore returns the store adapted by NewContextStore
+func unwrapContextStore(store ContextUcanStore) interface{} {
+	if cs, ok := store.(*contextStore); ok {
+		return cs.store
+	}
+	return store
+}
+
+var _ UcanStore = &ReadOnlyStore{}
+var _ ContextUcanStore = &ReadOnlyStore{}
+
+// ReadOnlyStore is a view of a store which fails writes with ReadOnlyStoreError
+type ReadOnlyStore struct {
+	store ContextUcanStore
+}
+
+func NewReadOnlyStore(store UcanStore) *ReadOnlyStore {
+	return &ReadOnlyStore{NewContextStore(store)}
+}
+
+func (ro *ReadOnlyStore) ReadUcan(c cid.Cid) (*Ucan, error) {
+	return ro.store.ReadUcanContext(context.Background(), c)
+}
+
+func (ro *ReadOnlyStore) WriteUcan(*Ucan, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ReadOnlyStoreError
+}
+
+func (ro *ReadOnlyStore) ReadUcanStr(c cid.Cid) (string, error) {
+	return ro.store.ReadUcanStrContext(context.Background(), c)
+}
+
+func (ro *ReadOnlyStore) WriteUcanStr(string, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ReadOnlyStoreError
+}
+
+func (ro *ReadOnlyStore) ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	return ro.store.ReadUcanContext(ctx, c)
+}
+
+func (ro *ReadOnlyStore) WriteUcanContext(context.Context, *Ucan, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ReadOnlyStoreError
+}
+
+func (ro *ReadOnlyStore) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	return ro.store.ReadUcanStrContext(ctx, c)
+}
+
+func (ro *ReadOnlyStore) WriteUcanStrContext(context.Context, string, *cid.Prefix) (cid.Cid, error) {
+	return cid.Undef, ReadOnlyStoreError
+}
+
+func (ro *ReadOnlyStore) Delete(cid.Cid) error {
+	return ReadOnlyStoreError
+}
+
+var _ UcanStore = &NamespacedStore{}
+var _ ContextUcanStore = &NamespacedStore{}
+
+// NamespacedStore is a view of a shared store which only sees the ucans
+// written through it, e.g. one view per tenant of a shared cache. The view is
+// process-local: membership is kept in memory only and is lost on restart, so
+// callers persisting the shared store must record the members of each
+// namespace themselves and restore them with WithMembers.
+type NamespacedStore struct {
+	store     ContextUcanStore
+	namespace string
+
+	lk      sync.RWMutex
+	members map[cid.Cid]bool
+}
+
+func NewNamespacedStore(store UcanStore, namespace string) *NamespacedStore {
+	return &NamespacedStore{
+		store:     NewContextStore(store),
+		namespace: namespace,
+		members:   make(map[cid.Cid]bool),
+	}
+}
+
+// WithMembers adds ucans of the shared store to the namespace
+func (ns *NamespacedStore) WithMembers(cids ...cid.Cid) *NamespacedStore {
+	ns.lk.Lock()
+	defer ns.lk.Unlock()
+	for _, c := range cids {
+		ns.members[c] = true
+	}
+	return ns
+}
+
+func (ns *NamespacedStore) Namespace() string {
+	return ns.namespace
+}
+
+func (ns *NamespacedStore) ReadUcan(c cid.Cid) (*Ucan, error) {
+	return ns.ReadUcanContext(context.Background(), c)
+}
+
+func (ns *NamespacedStore) WriteUcan(uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	return ns.WriteUcanContext(context.Background(), uc, prefix)
+}
+
+func (ns *NamespacedStore) ReadUcanStr(c cid.Cid) (string, error) {
+	return ns.ReadUcanStrContext(context.Background(), c)
+}
+
+func (ns *NamespacedStore) WriteUcanStr(str string, prefix *cid.Prefix) (cid.Cid, error) {
+	return ns.WriteUcanStrContext(context.Background(), str, prefix)
+}
+
+func (ns *NamespacedStore) ReadUcanContext(ctx context.Context, c cid.Cid) (*Ucan, error) {
+	if !ns.Has(c) {
+		return nil, fmt.Errorf("%w: %s in namespace %s", UcanNotFoundError, c.String(), ns.namespace)
+	}
+	return ns.store.ReadUcanContext(ctx, c)
+}
+
+func (ns *NamespacedStore) WriteUcanContext(ctx context.Context, uc *Ucan, prefix *cid.Prefix) (cid.Cid, error) {
+	c, err := ns.store.WriteUcanContext(ctx, uc, prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	ns.WithMembers(c)
+	return c, nil
+}
+
+func (ns *NamespacedStore) ReadUcanStrContext(ctx context.Context, c cid.Cid) (string, error) {
+	if !ns.Has(c) {
+		return "", fmt.Errorf("%w: %s in namespace %s", UcanNotFoundError, c.String(), ns.namespace)
+	}
+	return ns.store.ReadUcanStrContext(ctx, c)
+}
+
+func (ns *NamespacedStore) WriteUcanStrContext(ctx context.Context, str string, prefix *cid.Prefix) (cid.Cid, error) {
+	c, err := ns.store.WriteUcanStrContext(ctx, str, prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	ns.WithMembers(c)
+	return c, nil
+}
+
+// Has reports whether c was written through the namespace
+func (ns *NamespacedStore) Has(c cid.Cid) bool {
+	ns.lk.RLock()
+	defer ns.lk.RUnlock()
+	return ns.members[c]
+}
+
+// Delete removes c from the namespace, the shared store keeps it as other
+// namespaces may hold it too
+func (ns *NamespacedStore) Delete(c cid.Cid) error {
+	ns.lk.Lock()
+	defer ns.lk.Unlock()
+	delete(ns.members, c)
+	return nil
+}
+
+// List returns the cids of the namespace
+func (ns *NamespacedStore) List() ([]cid.Cid, error) {
+	ns.lk.RLock()
+	defer ns.lk.RUnlock()
+	cids := make([]cid.Cid, 0, len(ns.members))
+	for c := range ns.members {
+		cids = append(cids, c)
+	}
+	return cids, nil
+}
@@ -0,0 +1,97 @@
+package ucan
+
+import (
+	"context"
+	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTieredStorePromotesHits(t *testing.T) {
+	cache, persistent, remote := NewMemoryStore(), NewMemoryStore(), NewMemoryStore()
+	grant := buildLeaf(t, 60)
+	_, err := remote.WriteUcan(grant, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.BobKey).
+		ForAudience(fixtures.TestIdentities.MalloryDidString).
+		WithLifetime(50).
+		WitnessedBy(grant, nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewTieredStore(cache, persistent, NewReadOnlyStore(remote))
+	c, err := store.WriteUcan(leaf, nil)
+	assert.NoError(t, err)
+	assert.True(t, cache.Has(c))
+	assert.True(t, persistent.Has(c))
+
+	_, err = ProofChainFromUcanCid(c, nil, store)
+	assert.NoError(t, err)
+	grantCid, _, err := grant.ToCid(nil)
+	assert.NoError(t, err)
+	assert.True(t, cache.Has(grantCid))
+	assert.True(t, persistent.Has(grantCid))
+
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []cid.Cid{c, grantCid}, cids)
+
+	assert.NoError(t, store.Delete(grantCid))
+	assert.False(t, cache.Has(grantCid))
+	assert.True(t, remote.Has(grantCid))
+
+	_, err = NewTieredStore(cache).WithoutPromotion().ReadUcan(grantCid)
+	assert.ErrorIs(t, err, UcanNotFoundError)
+}
+
+func TestTieredStoreWritesBack(t *testing.T) {
+	cache, persistent := NewMemoryStore().WithMaxEntries(1), NewMemoryStore()
+	store := NewTieredStore(cache, persistent).WithWritePolicy(WriteBack)
+
+	a, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	assert.NoError(t, err)
+	b, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, persistent.Len())
+
+	// a was evicted from the cache but is still pending
+	assert.False(t, cache.Has(a))
+	_, err = store.ReadUcan(a)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Flush(context.Background()))
+	assert.True(t, persistent.Has(a))
+	assert.True(t, persistent.Has(b))
+}
+
+func TestReadOnlyAndNamespacedViews(t *testing.T) {
+	shared := NewMemoryStore()
+	_, err := NewReadOnlyStore(shared).WriteUcan(buildLeaf(t, 60), nil)
+	assert.ErrorIs(t, err, ReadOnlyStoreError)
+	_, err = NewTieredStore(NewReadOnlyStore(shared)).WriteUcan(buildLeaf(t, 60), nil)
+	assert.ErrorIs(t, err, ReadOnlyStoreError)
+
+	alice := NewNamespacedStore(shared, "alice")
+	bob := NewNamespacedStore(shared, "bob")
+	c, err := alice.WriteUcan(buildLeaf(t, 60), nil)
+	assert.NoError(t, err)
+	_, err = alice.ReadUcan(c)
+	assert.NoError(t, err)
+	_, err = bob.ReadUcan(c)
+	assert.ErrorIs(t, err, UcanNotFoundError)
+
+	_, err = bob.WithMembers(c).ReadUcan(c)
+	assert.NoError(t, err)
+	assert.NoError(t, alice.Delete(c))
+	assert.False(t, alice.Has(c))
+	assert.True(t, shared.Has(c))
+	cids, err := bob.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{c}, cids)
+}
@@ -1,9 +1,13 @@
 package ucan
 
 import (
+	"context"
 	"github.com/KenCloud-Tech/go-ucan-kc/test/fixtures"
+	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestStore(t *testing.T) {
@@ -28,3 +32,120 @@ func TestStore(t *testing.T) {
 
 	assert.Equal(t, ucan, reUcan)
 }
+
+func buildLeaf(t *testing.T, lifetime uint64) *Ucan {
+	uc, err := DefaultBuilder().
+		IssuedBy(fixtures.TestIdentities.AliceKey).
+		ForAudience(fixtures.TestIdentities.BobDidString).
+		WithLifetime(lifetime).
+		WithNonce().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uc
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewMemoryStore().WithMaxEntries(2)
+	a, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	assert.NoError(t, err)
+	b, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	assert.NoError(t, err)
+
+	_, err = store.ReadUcanStr(a)
+	assert.NoError(t, err)
+	c, err := store.WriteUcan(buildLeaf(t, 60), nil)
+	assert.NoError(t, err)
+
+	assert.True(t, store.Has(a))
+	assert.False(t, store.Has(b))
+	assert.True(t, store.Has(c))
+	_, err = store.ReadUcan(b)
+	assert.ErrorIs(t, err, UcanNotFoundError)
+
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{c, a}, cids)
+
+	assert.NoError(t, store.Delete(a))
+	assert.NoError(t, store.Delete(a))
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestMemoryStoreEvictsExpiredUcans(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time {
+		return now
+	}
+	short, err := store.WriteUcan(buildLeaf(t, 10), nil)
+	assert.NoError(t, err)
+	long, err := store.WriteUcan(buildLeaf(t, 120), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, store.Len())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, 2, store.Len())
+	assert.True(t, store.Has(short))
+	_, err = store.ReadUcanStr(short)
+	assert.NoError(t, err)
+
+	now = now.Add(DefaultStoreExpiryMargin)
+	_, err = store.WriteUcan(buildLeaf(t, 120), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, store.Len())
+	assert.False(t, store.Has(short))
+	_, err = store.ReadUcanStr(short)
+	assert.ErrorIs(t, err, UcanNotFoundError)
+	assert.True(t, store.Has(long))
+}
+
+func TestMemoryStoreEvictsExpiredUcansWithoutWrites(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time {
+		return now
+	}
+	short, err := store.WriteUcan(buildLeaf(t, 10), nil)
+	assert.NoError(t, err)
+	long, err := store.WriteUcan(buildLeaf(t, 3600), nil)
+	assert.NoError(t, err)
+
+	// a read only cache drops expired ucans on reads, Len and List
+	now = now.Add(time.Minute + DefaultStoreExpiryMargin)
+	_, err = store.PeekUcanStr(short)
+	assert.ErrorIs(t, err, UcanNotFoundError)
+	assert.Equal(t, 1, store.Len())
+	cids, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []cid.Cid{long}, cids)
+
+	now = now.Add(time.Hour)
+	assert.False(t, store.Has(long))
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestMemoryStoreIsSafeForConcurrentChainBuilding(t *testing.T) {
+	store := NewMemoryStore().WithMaxEntries(64)
+	ucans := make([]*Ucan, 8)
+	for i := range ucans {
+		ucans[i] = buildWideUcan(t, store, 4)
+	}
+
+	var wg sync.WaitGroup
+	for _, uc := range ucans {
+		wg.Add(1)
+		go func(uc *Ucan) {
+			defer wg.Done()
+			c, err := store.WriteUcan(uc, nil)
+			assert.NoError(t, err)
+			_, err = NewProofChainBuilder(store).WithConcurrency(4).FromUcanCid(context.Background(), c, nil)
+			assert.NoError(t, err)
+			_, err = store.List()
+			assert.NoError(t, err)
+		}(uc)
+	}
+	wg.Wait()
+	assert.Equal(t, 40, store.Len())
+}
@@ -23,6 +23,7 @@ var (
 	UcanForamtError     = fmt.Errorf("Invalid Ucan foramt")
 	UcanExpiredError    = fmt.Errorf("Expired")
 	UcanNotActiveError  = fmt.Errorf("Not active yet")
+	UcanRevokedError    = fmt.Errorf("Revoked")
 )
 
 type UcanHeader struct {
@@ -243,6 +244,19 @@ func (uc *Ucan) Encode() (string, error) {
 	return header + "." + payload + "." + signature, nil
 }
 
+// EncodeSigned returns the token as it was signed, decoded ucans whose header
+// or payload encode differently than they were signed keep their signature
+func (uc *Ucan) EncodeSigned() (string, error) {
+	if len(uc.DataToSign) == 0 {
+		return uc.Encode()
+	}
+	signature, err := mb.Encode(mb.Base64url, uc.Signature)
+	if err != nil {
+		return "", err
+	}
+	return string(uc.DataToSign) + "." + signature, nil
+}
+
 func (uc *Ucan) ToCid(prefix *cid.Prefix) (cid.Cid, string, error) {
 	if prefix == nil {
 		prefix = &DefaultPrefix
@@ -262,11 +276,11 @@ func (uc *Ucan) ToCid(prefix *cid.Prefix) (cid.Cid, string, error) {
 func (uc *Ucan) Equals(other *Ucan) bool {
 	ucBytes, err := json.Marshal(uc)
 	if err != nil {
-		panic(err.Error())
+		return false
 	}
 	otherBytes, err := json.Marshal(other)
 	if err != nil {
-		panic(err.Error())
+		return false
 	}
 	return bytes.Equal(ucBytes, otherBytes)
 }
@@ -284,10 +298,10 @@ func DecodeUcanString(ucStr string) (*Ucan, error) {
 	for i := range parts {
 		encoding, partsBytes[i], err = mb.Decode(parts[i])
 		if err != nil {
-			return nil, fmt.Errorf("%d-%v", EncodingError, err)
+			return nil, fmt.Errorf("%w: %v", EncodingError, err)
 		}
 		if encoding != mb.Base64url {
-			return nil, fmt.Errorf("%d-%d", UcanForamtError, EncodingError)
+			return nil, fmt.Errorf("%w: %v", UcanForamtError, EncodingError)
 		}
 	}
 
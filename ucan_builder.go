@@ -14,7 +14,7 @@ import (
 // todo: just for test
 var randSource = rand.New(rand.NewSource(time.Now().Unix()))
 
-func mustJson(a interface{}) interface{} {
+func checkJson(a interface{}) error {
 	var jsonBytes []byte
 	switch a.(type) {
 	case string:
@@ -22,14 +22,13 @@ func mustJson(a interface{}) interface{} {
 	case []byte:
 		jsonBytes = a.([]byte)
 	default:
-		panic(fmt.Sprintf("%v is not json object", a))
+		return fmt.Errorf("%v is not json object", a)
 	}
 
-	if json.Valid(jsonBytes) {
-		return a
-	} else {
-		panic(fmt.Sprintf("%v is not json object", a))
+	if !json.Valid(jsonBytes) {
+		return fmt.Errorf("%v is not json object", a)
 	}
+	return nil
 }
 
 type UcanBuilder struct {
@@ -44,6 +43,9 @@ type UcanBuilder struct {
 	facts    map[string]interface{}
 	proofs   []string
 	addNonce bool
+
+	// err is the first error of a chained call, returned by Build
+	err error
 }
 
 func DefaultBuilder() *UcanBuilder {
@@ -80,10 +82,21 @@ func (ub *UcanBuilder) WithNotBefore(timestamp int64) *UcanBuilder {
 }
 
 func (ub *UcanBuilder) WithFact(key string, fact interface{}) *UcanBuilder {
-	ub.facts[key] = mustJson(fact)
+	if err := checkJson(fact); err != nil {
+		ub.fail(fmt.Errorf("invalid fact %s: %w", key, err))
+		return ub
+	}
+	ub.facts[key] = fact
 	return ub
 }
 
+// fail records the first error of the chained calls
+func (ub *UcanBuilder) fail(err error) {
+	if ub.err == nil {
+		ub.err = err
+	}
+}
+
 func (ub *UcanBuilder) WithNonce() *UcanBuilder {
 	ub.addNonce = true
 	return ub
@@ -92,7 +105,8 @@ func (ub *UcanBuilder) WithNonce() *UcanBuilder {
 func (ub *UcanBuilder) WitnessedBy(authority *Ucan, prefix *cid.Prefix) *UcanBuilder {
 	c, _, err := authority.ToCid(prefix)
 	if err != nil {
-		panic(err.Error())
+		ub.fail(fmt.Errorf("invalid proof: %w", err))
+		return ub
 	}
 	ub.proofs = append(ub.proofs, c.String())
 	return ub
@@ -113,18 +127,20 @@ func (ub *UcanBuilder) ClaimingCapabilities(capabilities []*Capability) *UcanBui
 func (ub *UcanBuilder) DelegatingFrom(authority *Ucan, prefix *cid.Prefix) *UcanBuilder {
 	c, _, err := authority.ToCid(prefix)
 	if err != nil {
-		panic(err.Error())
+		ub.fail(fmt.Errorf("invalid proof: %w", err))
+		return ub
 	}
-	ub.proofs = append(ub.proofs, c.String())
-	prfIdx := len(ub.proofs) - 1
+	prfIdx := len(ub.proofs)
 	capability, err := ProofDelegationSemantics.Parse(fmt.Sprintf("prf:%d", prfIdx), "ucan/DELEGATE", []byte(""))
 	if err != nil {
-		panic(err.Error())
+		ub.fail(err)
+		return ub
 	}
+	ub.proofs = append(ub.proofs, c.String())
 	ub.capabilities = append(ub.capabilities, Capability{
 		Resource: capability.Resource.ToString(),
 		Ability:  capability.Ability.ToString(),
-		Caveat:   capability.Caveat,
+		Caveat:   string(capability.Caveat),
 	})
 	return ub
 }
@@ -150,6 +166,9 @@ func (ub *UcanBuilder) NotBefore() *int64 {
 }
 
 func (ub *UcanBuilder) Build() (*Ucan, error) {
+	if ub.err != nil {
+		return nil, ub.err
+	}
 	if ub.issuer == nil {
 		return nil, fmt.Errorf("nil issuer")
 	}
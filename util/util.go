@@ -31,13 +31,21 @@ func IsJsonObject(val []byte) bool {
 	return true
 }
 
-func CaveatBytes(caveat interface{}) []byte {
+// CaveatBytes returns the json bytes of a caveat, caveats decoded from tokens
+// as json values instead of strings are marshalled back to json
+func CaveatBytes(caveat interface{}) ([]byte, error) {
 	switch caveat.(type) {
+	case nil:
+		return nil, nil
 	case string:
-		return []byte(caveat.(string))
+		return []byte(caveat.(string)), nil
 	case []byte:
-		return caveat.([]byte)
+		return caveat.([]byte), nil
 	default:
-		panic(fmt.Sprintf("can not convert caveat: %v to bytes", caveat))
+		jsonBytes, err := json.Marshal(caveat)
+		if err != nil {
+			return nil, fmt.Errorf("can not convert caveat: %v to bytes: %w", caveat, err)
+		}
+		return jsonBytes, nil
 	}
 }